@@ -0,0 +1,151 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrorKind is the category of an Error.
+type ErrorKind int
+
+const (
+	// ConfigError is an invalid charts configuration, or chart configuration.
+	ConfigError ErrorKind = iota + 1
+
+	// ResolutionError is a chart, chart version or dependency that cannot be
+	// found, or that does not match its lock.
+	ResolutionError
+
+	// NetworkError is a failure to download a chart, or a repository index.
+	NetworkError
+
+	// RenderError is a failure to render the templates of a chart, or to
+	// process the rendered resources.
+	RenderError
+
+	// ValidationError is a chart's values, or a rendered resource, not
+	// matching its schema or the configured policies.
+	ValidationError
+
+	// ArgumentError is an invalid combination of command line arguments.
+	ArgumentError
+
+	// IOError is a failure to read or write a file, such as the lockfile, the
+	// state file, or the output.
+	IOError
+)
+
+var errorKinds = map[ErrorKind]string{
+	ConfigError:     "charts config",
+	ResolutionError: "chart resolution",
+	NetworkError:    "network",
+	RenderError:     "chart rendering",
+	ValidationError: "validation",
+	ArgumentError:   "kubecrt arguments",
+	IOError:         "IO",
+}
+
+// String returns a description of the kind of error.
+func (k ErrorKind) String() string {
+	if s, ok := errorKinds[k]; ok {
+		return s
+	}
+
+	return "unknown"
+}
+
+// Error is an error that occurred while loading or rendering charts, along
+// with the chart, chart version and template it occurred in, if known.
+type Error struct {
+	Kind     ErrorKind
+	Chart    string
+	Version  string
+	Template string
+	Err      error
+}
+
+// renderError matches the errors returned by the template engine, to extract
+// the template they occurred in.
+var renderError = regexp.MustCompile(`^render error in "([^"]+)": (?s)(.*)$`)
+
+func (e *Error) Error() string {
+	msg := e.Err.Error()
+
+	if e.Template != "" {
+		msg = e.Template + ": " + msg
+	}
+
+	switch {
+	case e.Chart != "" && e.Version != "":
+		return fmt.Sprintf("%s (%s): %s", e.Chart, e.Version, msg)
+	case e.Chart != "":
+		return fmt.Sprintf("%s: %s", e.Chart, msg)
+	default:
+		return msg
+	}
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WrapError returns err as an Error of the given kind, in the context of the
+// chart. If err already is, or wraps, an Error, its kind is kept, and only the
+// missing chart context is added. A nil error is returned as nil.
+func (c *Chart) WrapError(kind ErrorKind, err error) error {
+	return c.wrapError(kind, "", "", err)
+}
+
+// wrapError returns err as an Error of the given kind, in the context of the
+// chart, the loaded chart version, and the template the error occurred in, if
+// known.
+func (c *Chart) wrapError(kind ErrorKind, version, template string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	e, ok := err.(*Error)
+	if !ok {
+		var inner *Error
+		if errors.As(err, &inner) {
+			kind = inner.Kind
+		} else if m := renderError.FindStringSubmatch(err.Error()); m != nil {
+			template, err = m[1], errors.New(m[2])
+		}
+
+		e = &Error{Kind: kind, Err: err}
+	}
+
+	if e.Chart == "" {
+		e.Chart = c.Location
+	}
+
+	if e.Version == "" {
+		e.Version = version
+	}
+
+	if e.Version == "" {
+		e.Version = c.version()
+	}
+
+	if e.Template == "" {
+		e.Template = template
+	}
+
+	return e
+}
+
+// version returns the resolved version of the chart, or the configured
+// version constraint if it is not resolved yet.
+func (c *Chart) version() string {
+	switch {
+	case c.Resolved != nil:
+		return c.Resolved.Version
+	case c.Locked != nil:
+		return c.Locked.Version
+	default:
+		return c.Version
+	}
+}
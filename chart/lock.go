@@ -0,0 +1,92 @@
+package chart
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blendle/kubecrt/helm"
+)
+
+// Lock records the exact version a chart version constraint resolved to.
+type Lock struct {
+	Location   string `yaml:"location"`
+	Constraint string `yaml:"constraint,omitempty"`
+	Repo       string `yaml:"repo"`
+	Version    string `yaml:"version"`
+	Digest     string `yaml:"digest,omitempty"`
+}
+
+// Matches returns true if the lock was resolved for the chart's current
+// location, version constraint and repository.
+func (l *Lock) Matches(c *Chart) bool {
+	if l.Location != c.Location || l.Constraint != c.Version {
+		return false
+	}
+
+	return c.Repo == "" || c.Repo == l.Repo
+}
+
+// lock records the resolved version of the chart, verifying it against the
+// locked version, if any. Local charts are never locked.
+func (c *Chart) lock(path, version string) error {
+	if isLocalPath(c.Location) {
+		return nil
+	}
+
+	digest, err := archiveDigest(path)
+	if err != nil {
+		return err
+	}
+
+	if c.Locked != nil && c.Locked.Digest != "" && digest != "" && c.Locked.Digest != digest {
+		return fmt.Errorf(
+			"digest of version %s (%s) does not match the locked digest (%s)",
+			version, digest, c.Locked.Digest,
+		)
+	}
+
+	repo := c.Repo
+	if repo == "" {
+		repo = helm.RepositoryURL(strings.Split(c.Location, "/")[0])
+	}
+
+	c.Resolved = &Lock{
+		Location:   c.Location,
+		Constraint: c.Version,
+		Repo:       repo,
+		Version:    version,
+		Digest:     digest,
+	}
+
+	return nil
+}
+
+// archiveDigest returns the SHA256 digest of a chart archive. Unpacked charts
+// have no digest.
+func archiveDigest(path string) (string, error) {
+	if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func isLocalPath(name string) bool {
+	if _, err := os.Stat(name); err == nil {
+		return true
+	}
+
+	return filepath.IsAbs(name) || strings.HasPrefix(name, ".")
+}
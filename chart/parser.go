@@ -1,6 +1,7 @@
 package chart
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -8,13 +9,11 @@ import (
 	"strings"
 
 	"github.com/blendle/kubecrt/helm"
+	"github.com/blendle/kubecrt/manifest"
 
 	yaml "gopkg.in/yaml.v2"
 	"k8s.io/helm/pkg/chartutil"
-	"k8s.io/helm/pkg/downloader"
 	"k8s.io/helm/pkg/engine"
-	"k8s.io/helm/pkg/getter"
-	"k8s.io/helm/pkg/helm/environment"
 	"k8s.io/helm/pkg/helm/helmpath"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 	"k8s.io/helm/pkg/timeconv"
@@ -22,26 +21,58 @@ import (
 
 // Chart ...
 type Chart struct {
-	Version  string      `yaml:"version"`
-	Repo     string      `yaml:"repo"`
-	Values   interface{} `yaml:"values"`
-	Location string
+	Name              string            `yaml:"name"`
+	Namespace         string            `yaml:"namespace"`
+	Version           string            `yaml:"version"`
+	Repo              string            `yaml:"repo"`
+	Values            interface{}       `yaml:"values"`
+	ValuesFiles       []string          `yaml:"valuesFiles"`
+	Hooks             string            `yaml:"hooks"`
+	HookTypes         []string          `yaml:"hookTypes"`
+	EnforceNamespace  string            `yaml:"enforceNamespace"`
+	PostRenderers     []*PostRenderer   `yaml:"postRenderers"`
+	Patches           []*Patch          `yaml:"patches"`
+	CommonLabels      map[string]string `yaml:"commonLabels"`
+	CommonAnnotations map[string]string `yaml:"commonAnnotations"`
+	ConfigHash        *bool             `yaml:"configHash"`
+	NameSuffixHash    *bool             `yaml:"nameSuffixHash"`
+	Location          string
+
+	// Locked pins the chart to a previously resolved version.
+	Locked *Lock `yaml:"-"`
+
+	// Resolved is set by ParseChart to the chart version that was rendered.
+	// Local charts are never resolved.
+	Resolved *Lock `yaml:"-"`
+
+	// SharedValues are the values shared by all charts, already merged into
+	// Values. They are never reported as unknown values.
+	SharedValues map[string]interface{} `yaml:"-"`
+
+	// Capabilities are the capabilities of the cluster the chart is rendered
+	// for. If nil, Helm's default capabilities are used.
+	Capabilities *chartutil.Capabilities `yaml:"-"`
+
+	// Warnings are set by ParseChart, and contain any non-fatal problems found
+	// while rendering the chart.
+	Warnings []string `yaml:"-"`
 }
 
-// ParseChart ...
-func (c *Chart) ParseChart(name, namespace string) ([]byte, error) {
+// ParseChart renders the chart, and returns the resulting manifests, ordered by
+// their template path.
+func (c *Chart) ParseChart(name, namespace string) ([]*manifest.Manifest, error) {
 	s := strings.Split(c.Location, "/")
 
 	if len(s) == 2 && c.Repo != "" {
 		err := helm.AddRepository(s[0], c.Repo)
 		if err != nil {
-			return nil, err
+			return nil, c.WrapError(NetworkError, err)
 		}
 	}
 
 	d, err := yaml.Marshal(c.Values)
 	if err != nil {
-		return nil, err
+		return nil, c.WrapError(ConfigError, err)
 	}
 
 	tmpfile, err := ioutil.TempFile("", "")
@@ -66,26 +97,52 @@ func (c *Chart) ParseChart(name, namespace string) ([]byte, error) {
 	return resources, nil
 }
 
-func (c *Chart) compile(releaseName, namespace, values string) ([]byte, error) {
-	var output string
+func (c *Chart) compile(releaseName, namespace, values string) ([]*manifest.Manifest, error) {
+	var ms []*manifest.Manifest
+
+	version := c.Version
+	if c.Locked != nil {
+		version = c.Locked.Version
+	}
 
-	location, err := locateChartPath(c.Location, c.Version)
+	location, err := locateChartPath(c.Location, version)
 	if err != nil {
-		return nil, err
+		return nil, c.WrapError(ResolutionError, err)
 	}
 
 	cr, err := chartutil.Load(location)
 	if err != nil {
-		return nil, err
+		return nil, c.WrapError(ResolutionError, err)
+	}
+
+	// fail returns err in the context of the loaded chart version.
+	fail := func(kind ErrorKind, err error) error {
+		return c.wrapError(kind, cr.Metadata.Version, "", err)
+	}
+
+	if err = c.lock(location, cr.Metadata.Version); err != nil {
+		return nil, fail(ResolutionError, err)
+	}
+
+	if err = loadDependencies(cr, location); err != nil {
+		return nil, fail(ResolutionError, err)
 	}
 
 	vv, err := vals(values)
 	if err != nil {
-		return nil, err
+		return nil, fail(ConfigError, err)
 	}
 
 	config := &chart.Config{Raw: string(vv), Values: map[string]*chart.Value{}}
 
+	if err = chartutil.ProcessRequirementsEnabled(cr, config); err != nil {
+		return nil, fail(RenderError, err)
+	}
+
+	if err = chartutil.ProcessRequirementsImportValues(cr); err != nil {
+		return nil, fail(RenderError, err)
+	}
+
 	options := chartutil.ReleaseOptions{
 		Name:      releaseName,
 		Time:      timeconv.Now(),
@@ -94,14 +151,34 @@ func (c *Chart) compile(releaseName, namespace, values string) ([]byte, error) {
 
 	renderer := engine.New()
 
-	vals, err := chartutil.ToRenderValues(cr, config, options)
+	caps := c.Capabilities
+	if caps == nil {
+		caps = &chartutil.Capabilities{APIVersions: chartutil.DefaultVersionSet}
+	}
+
+	vals, err := chartutil.ToRenderValuesCaps(cr, config, options, caps)
 	if err != nil {
-		return nil, err
+		return nil, fail(ConfigError, err)
+	}
+
+	merged, _ := vals["Values"].(chartutil.Values)
+	if err = validateValues(cr, merged); err != nil {
+		return nil, fail(ValidationError, err)
+	}
+
+	user, err := chartutil.ReadValues(vv)
+	if err != nil {
+		return nil, fail(ConfigError, err)
+	}
+
+	c.Warnings = nil
+	for _, k := range unknownValues(cr, withoutValues(user, c.SharedValues)) {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("value %q is not defined in the chart's default values", k))
 	}
 
 	out, err := renderer.Render(cr, vals)
 	if err != nil {
-		return nil, err
+		return nil, fail(RenderError, err)
 	}
 
 	for name, data := range out {
@@ -112,24 +189,23 @@ func (c *Chart) compile(releaseName, namespace, values string) ([]byte, error) {
 		if strings.HasPrefix(b, "_") {
 			continue
 		}
-		if strings.TrimSpace(data) == "" {
-			continue
-		}
 
-		data = strings.TrimSpace(data)
-
-		if !strings.HasPrefix(data, "---\n") {
-			data = "---\n" + data
+		m, err := manifest.Split(c.Location, name, data)
+		if err != nil {
+			msg := strings.TrimPrefix(err.Error(), name+": ")
+			return nil, c.wrapError(RenderError, cr.Metadata.Version, name, errors.New(msg))
 		}
 
-		if output != "" {
-			data = "\n\n" + data
+		for i := range m {
+			m[i].Release = releaseName
 		}
 
-		output = output + data
+		ms = append(ms, m...)
 	}
 
-	return []byte(strings.Trim(output, "\n") + "\n"), nil
+	manifest.SortByTemplate(ms)
+
+	return ms, nil
 }
 
 func vals(valuesPath string) ([]byte, error) {
@@ -170,14 +246,8 @@ func locateChartPath(name, version string) (string, error) {
 		return filepath.Abs(crepo)
 	}
 
-	settings := environment.EnvSettings{
-		Home: helmpath.Home(environment.DefaultHelmHome),
-	}
-
-	dl := downloader.ChartDownloader{
-		HelmHome: helmpath.Home(homepath),
-		Out:      os.Stdout,
-		Getters:  getter.All(settings),
+	if helm.Offline {
+		return helm.CachedChart(filepath.Dir(crepo), name, version)
 	}
 
 	err := os.MkdirAll(filepath.Dir(crepo), 0755)
@@ -190,10 +260,10 @@ func locateChartPath(name, version string) (string, error) {
 		return "", err
 	}
 
-	filename, _, err := dl.DownloadTo(name, version, filepath.Dir(crepo))
+	path, err := helm.DownloadChart(helmpath.Home(homepath), name, version, filepath.Dir(crepo))
 	if err != nil {
-		return "", err
+		return "", &Error{Kind: NetworkError, Err: err}
 	}
 
-	return filename, nil
+	return path, nil
 }
@@ -0,0 +1,245 @@
+package chart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blendle/kubecrt/manifest"
+	"github.com/blendle/kubecrt/schema"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/ghodss/yaml"
+	yamlv2 "gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Patch modifies the rendered resources of a chart that match its target. The
+// patch is either a strategic merge patch (a map), or a JSON 6902 patch (a
+// list of operations), given as YAML, or as a string containing YAML.
+type Patch struct {
+	Target *PatchTarget `yaml:"target"`
+	Patch  interface{}  `yaml:"patch"`
+}
+
+// PatchTarget selects the resources a patch applies to. Empty fields match
+// any resource. Resources without a namespace are considered to be in the
+// namespace the chart is rendered in.
+type PatchTarget struct {
+	Group         string `yaml:"group"`
+	Version       string `yaml:"version"`
+	Kind          string `yaml:"kind"`
+	Name          string `yaml:"name"`
+	Namespace     string `yaml:"namespace"`
+	LabelSelector string `yaml:"labelSelector"`
+}
+
+// String returns a description of the target.
+func (t *PatchTarget) String() string {
+	var s []string
+
+	for _, f := range []struct{ name, value string }{
+		{"group", t.Group},
+		{"version", t.Version},
+		{"kind", t.Kind},
+		{"name", t.Name},
+		{"namespace", t.Namespace},
+		{"labelSelector", t.LabelSelector},
+	} {
+		if f.value != "" {
+			s = append(s, f.name+"="+f.value)
+		}
+	}
+
+	if len(s) == 0 {
+		return "(any)"
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// Validate checks that the patch and its target are valid.
+func (p *Patch) Validate() error {
+	_, _, err := p.parse()
+	return err
+}
+
+// Apply applies the patch to the manifests matching its target, rendered in
+// the given namespace. It is an error if the target matches no manifests.
+func (p *Patch) Apply(ms []*manifest.Manifest, namespace string, sp *schema.Patcher) error {
+	doc, target, err := p.parse()
+	if err != nil {
+		return err
+	}
+
+	selector, err := labels.Parse(target.LabelSelector)
+	if err != nil {
+		return fmt.Errorf("invalid labelSelector: %s", err)
+	}
+
+	var matched bool
+
+	for _, m := range ms {
+		if !target.matches(m, namespace, selector) {
+			continue
+		}
+		matched = true
+
+		content, err := yaml.YAMLToJSON([]byte(m.Content))
+		if err != nil {
+			return fmt.Errorf("%s: %s", m.Template, err)
+		}
+
+		switch d := doc.(type) {
+		case []interface{}:
+			content, err = applyJSONPatch(content, d)
+		case map[string]interface{}:
+			content, err = applyStrategicMerge(content, d, m.Head, sp)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %s %s: %s", m.Template, m.Head.Kind, m.Head.Metadata.Name, err)
+		}
+
+		out, err := yaml.JSONToYAML(content)
+		if err != nil {
+			return err
+		}
+
+		if err = m.SetContent(string(out)); err != nil {
+			return err
+		}
+	}
+
+	if !matched {
+		return fmt.Errorf("no resources match patch target %s", target)
+	}
+
+	return nil
+}
+
+// parse returns the patch document in its JSON representation, and its
+// target. Strategic merge patches without a target apply to the resource with
+// the apiVersion, kind and name defined in the patch, so that they never match
+// all resources by accident.
+func (p *Patch) parse() (interface{}, *PatchTarget, error) {
+	var b []byte
+	var err error
+
+	if s, ok := p.Patch.(string); ok {
+		b = []byte(s)
+	} else if b, err = yamlv2.Marshal(p.Patch); err != nil {
+		return nil, nil, err
+	}
+
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid patch: %s", err)
+	}
+
+	var doc interface{}
+	if err = json.Unmarshal(j, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid patch: %s", err)
+	}
+
+	target := p.Target
+
+	switch d := doc.(type) {
+	case []interface{}:
+		if target == nil {
+			return nil, nil, errors.New("JSON 6902 patches require a target")
+		}
+
+		if _, err = jsonpatch.DecodePatch(j); err != nil {
+			return nil, nil, fmt.Errorf("invalid patch: %s", err)
+		}
+	case map[string]interface{}:
+		if target == nil {
+			target = targetOf(d)
+
+			if target.Kind == "" || target.Name == "" {
+				return nil, nil, errors.New("strategic merge patches without a target require a kind and metadata.name")
+			}
+		}
+	default:
+		return nil, nil, errors.New("invalid patch: expected a map (strategic merge patch) or a list (JSON 6902 patch)")
+	}
+
+	if _, err = labels.Parse(target.LabelSelector); err != nil {
+		return nil, nil, fmt.Errorf("invalid labelSelector: %s", err)
+	}
+
+	return doc, target, nil
+}
+
+func (t *PatchTarget) matches(m *manifest.Manifest, namespace string, selector labels.Selector) bool {
+	if m.Head.Kind == "" {
+		return false
+	}
+
+	group, version := "", m.Head.APIVersion
+	if i := strings.LastIndex(version, "/"); i >= 0 {
+		group, version = version[:i], version[i+1:]
+	}
+
+	ns := m.Head.Metadata.Namespace
+	if ns == "" {
+		ns = namespace
+	}
+
+	return (t.Group == "" || t.Group == group) &&
+		(t.Version == "" || t.Version == version) &&
+		(t.Kind == "" || t.Kind == m.Head.Kind) &&
+		(t.Name == "" || t.Name == m.Head.Metadata.Name) &&
+		(t.Namespace == "" || t.Namespace == ns) &&
+		selector.Matches(labels.Set(m.Head.Metadata.Labels))
+}
+
+// targetOf returns the target defined by the apiVersion, kind and metadata of
+// a strategic merge patch.
+func targetOf(patch map[string]interface{}) *PatchTarget {
+	t := &PatchTarget{}
+
+	apiVersion, _ := patch["apiVersion"].(string)
+	t.Version = apiVersion
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		t.Group, t.Version = apiVersion[:i], apiVersion[i+1:]
+	}
+
+	t.Kind, _ = patch["kind"].(string)
+
+	if meta, ok := patch["metadata"].(map[string]interface{}); ok {
+		t.Name, _ = meta["name"].(string)
+		t.Namespace, _ = meta["namespace"].(string)
+	}
+
+	return t
+}
+
+func applyJSONPatch(content []byte, ops []interface{}) ([]byte, error) {
+	b, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := jsonpatch.DecodePatch(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return patch.Apply(content)
+}
+
+func applyStrategicMerge(content []byte, patch map[string]interface{}, head *manifest.Head, sp *schema.Patcher) ([]byte, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(content, &obj); err != nil {
+		return nil, err
+	}
+
+	out, err := sp.StrategicMerge(head.APIVersion, head.Kind, obj, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(out)
+}
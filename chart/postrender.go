@@ -0,0 +1,95 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/blendle/kubecrt/manifest"
+)
+
+// PostRenderer is an external command that modifies the rendered resources of
+// a chart. It receives the resources as a YAML stream on stdin, and has to
+// print the resulting resources as a YAML stream to stdout.
+type PostRenderer struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+
+	// Dir is the directory the command is run in, and relative to which the
+	// command is resolved, if it is a relative path.
+	Dir string `yaml:"-"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. A post-renderer is either the
+// command as a string, or a map with the command and its arguments.
+func (p *PostRenderer) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		p.Command = command
+		return nil
+	}
+
+	type postRenderer PostRenderer
+	return unmarshal((*postRenderer)(p))
+}
+
+// String returns the command line of the post-renderer.
+func (p *PostRenderer) String() string {
+	return strings.Join(append([]string{p.Command}, p.Args...), " ")
+}
+
+// Run passes the manifests through the post-renderer, and returns the
+// resulting manifests. Resulting manifests keep the template of the manifest
+// with the same kind and name they were rendered from, if any.
+func (p *PostRenderer) Run(ms []*manifest.Manifest) ([]*manifest.Manifest, error) {
+	if len(ms) == 0 {
+		return ms, nil
+	}
+
+	command := p.Command
+	if strings.ContainsRune(command, filepath.Separator) && !filepath.IsAbs(command) {
+		command = filepath.Join(p.Dir, command)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(command, p.Args...)
+	cmd.Dir = p.Dir
+	cmd.Stdin = bytes.NewReader(manifest.Encode(ms))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, fmt.Errorf("post-renderer %q failed: %s", p, err)
+		}
+
+		return nil, fmt.Errorf("post-renderer %q failed: %s:\n%s", p, err, msg)
+	}
+
+	// Resources added by the post-renderer are attributed to a virtual
+	// template, within the same chart directory as the original templates.
+	fallback := strings.SplitN(ms[0].Template, "/", 2)[0] + "/post-renderer"
+
+	out, err := manifest.Split(ms[0].Chart, fallback, stdout.String())
+	if err != nil {
+		return nil, fmt.Errorf("post-renderer %q returned invalid YAML: %s", p, err)
+	}
+
+	for _, m := range out {
+		m.Release = ms[0].Release
+		m.Template = fallback
+
+		for _, o := range ms {
+			if o.Head.Kind == m.Head.Kind && o.Head.Metadata.Name == m.Head.Metadata.Name {
+				m.Template = o.Template
+				break
+			}
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,150 @@
+package chart
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blendle/kubecrt/helm"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/version"
+)
+
+// loadDependencies adds the dependencies declared in the requirements.yaml file
+// of a chart that are not vendored in its charts/ directory. Vendored charts of
+// a version not matching any of the declared constraints are replaced.
+// Dependencies are resolved using the versions in requirements.lock, if the
+// chart has one.
+func loadDependencies(cr *chart.Chart, location string) error {
+	reqs, err := chartutil.LoadRequirements(cr)
+	if err == chartutil.ErrRequirementsNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid requirements.yaml: %s", err)
+	}
+
+	locked := map[string]string{}
+	if l, err := chartutil.LoadRequirementsLock(cr); err == nil {
+		for _, d := range l.Dependencies {
+			locked[d.Name+" "+d.Repository] = d.Version
+		}
+	}
+
+	cr.Dependencies = withoutStale(cr.Dependencies, reqs.Dependencies)
+
+	for _, d := range reqs.Dependencies {
+		if vendored(cr, d) {
+			continue
+		}
+
+		v := d.Version
+		if lv, ok := locked[d.Name+" "+d.Repository]; ok {
+			v = lv
+		}
+
+		path, err := locateDependency(d.Name, v, d.Repository, location)
+		if err != nil {
+			return fmt.Errorf("dependency %s: %w", d.Name, err)
+		}
+
+		sub, err := chartutil.Load(path)
+		if err != nil {
+			return fmt.Errorf("dependency %s: %s", d.Name, err)
+		}
+
+		if err = loadDependencies(sub, path); err != nil {
+			return fmt.Errorf("dependency %s: %w", d.Name, err)
+		}
+
+		cr.Dependencies = append(cr.Dependencies, sub)
+	}
+
+	return nil
+}
+
+// vendored returns whether a version of the dependency matching its constraint
+// is present in the charts/ directory of the chart.
+func vendored(cr *chart.Chart, d *chartutil.Dependency) bool {
+	for _, dep := range cr.Dependencies {
+		if satisfies(dep, d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withoutStale returns the vendored charts, without those declared as a
+// dependency that do not satisfy the version constraint of any declaration.
+// Helm would otherwise render them as an additional subchart, next to the
+// matching version.
+func withoutStale(charts []*chart.Chart, deps []*chartutil.Dependency) []*chart.Chart {
+	var out []*chart.Chart
+
+	for _, c := range charts {
+		var declared, satisfied bool
+
+		for _, d := range deps {
+			declared = declared || declares(c, d)
+			satisfied = satisfied || satisfies(c, d)
+		}
+
+		if !declared || satisfied {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// declares returns whether the chart is the one declared by the dependency,
+// by its name, or by its alias, if set.
+func declares(c *chart.Chart, d *chartutil.Dependency) bool {
+	return c.Metadata.Name == d.Name || (d.Alias != "" && c.Metadata.Name == d.Alias)
+}
+
+// satisfies returns whether the chart is declared by the dependency, in a
+// version matching its constraint. Without a constraint, any version matches.
+func satisfies(c *chart.Chart, d *chartutil.Dependency) bool {
+	return declares(c, d) && (d.Version == "" || version.IsCompatibleRange(d.Version, c.Metadata.Version))
+}
+
+// locateDependency returns the path of a dependency. The repository is either
+// a "file://" path relative to the chart, the name of a repository ("@name" or
+// "alias:name"), or the URL of a repository, which is added to the Helm index
+// if no repository with that URL exists yet.
+func locateDependency(name, version, repository, location string) (string, error) {
+	switch {
+	case repository == "":
+		return "", fmt.Errorf("no repository defined in requirements.yaml")
+
+	case strings.HasPrefix(repository, "file://"):
+		if fi, err := os.Stat(location); err != nil || !fi.IsDir() {
+			return "", fmt.Errorf("%s: local dependencies are only supported for unpacked charts", repository)
+		}
+
+		return locateChartPath(filepath.Join(location, strings.TrimPrefix(repository, "file://")), "")
+
+	case strings.HasPrefix(repository, "@"):
+		return locateChartPath(strings.TrimPrefix(repository, "@")+"/"+name, version)
+
+	case strings.HasPrefix(repository, "alias:"):
+		return locateChartPath(strings.TrimPrefix(repository, "alias:")+"/"+name, version)
+	}
+
+	repo := helm.RepositoryName(repository)
+	if repo == "" {
+		repo = fmt.Sprintf("kubecrt-%x", sha256.Sum256([]byte(repository)))[:16]
+
+		if err := helm.AddRepository(repo, repository); err != nil {
+			return "", &Error{Kind: NetworkError, Err: err}
+		}
+	}
+
+	return locateChartPath(repo+"/"+name, version)
+}
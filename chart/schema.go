@@ -0,0 +1,133 @@
+package chart
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/xeipuuv/gojsonschema"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+const valuesSchemaFile = "values.schema.json"
+
+// validateValues validates the merged values of a chart, and its subcharts,
+// against their values.schema.json file, if any.
+func validateValues(cr *chart.Chart, vals map[string]interface{}) error {
+	var errs []string
+
+	if err := validateChartValues(cr, vals, cr.Metadata.Name, &errs); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errors.New("values don't meet the specifications of the schema:\n" + strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+func validateChartValues(cr *chart.Chart, vals map[string]interface{}, path string, errs *[]string) error {
+	for _, f := range cr.Files {
+		if f.TypeUrl != valuesSchemaFile {
+			continue
+		}
+
+		b, err := yaml.Marshal(vals)
+		if err != nil {
+			return err
+		}
+
+		doc, err := yaml.YAMLToJSON(b)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(doc, []byte("null")) {
+			doc = []byte("{}")
+		}
+
+		res, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(f.Value), gojsonschema.NewBytesLoader(doc))
+		if err != nil {
+			return fmt.Errorf("%s: invalid %s: %s", path, valuesSchemaFile, err)
+		}
+
+		for _, e := range res.Errors() {
+			*errs = append(*errs, fmt.Sprintf("- %s: %s", path, e))
+		}
+	}
+
+	for _, dep := range cr.Dependencies {
+		sub, _ := vals[dep.Metadata.Name].(map[string]interface{})
+		if err := validateChartValues(dep, sub, path+"/"+dep.Metadata.Name, errs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unknownValues returns the paths of all user-supplied values that do not
+// exist in the chart's default values. Values for subcharts are compared to the
+// subchart's default values, and global values are ignored.
+func unknownValues(cr *chart.Chart, user map[string]interface{}) []string {
+	defaults := map[string]interface{}{}
+	if cr.Values != nil {
+		defaults, _ = chartutil.ReadValues([]byte(cr.Values.Raw))
+	}
+
+	subcharts := map[string]*chart.Chart{}
+	for _, dep := range cr.Dependencies {
+		subcharts[dep.Metadata.Name] = dep
+	}
+
+	var unknown []string
+
+	for k, v := range user {
+		if k == chartutil.GlobalKey {
+			continue
+		}
+
+		if sub, ok := subcharts[k]; ok {
+			if vals, ok := v.(map[string]interface{}); ok {
+				for _, p := range unknownValues(sub, vals) {
+					unknown = append(unknown, k+"."+p)
+				}
+			}
+			continue
+		}
+
+		unknown = append(unknown, unknownKeys(k, k, defaults, v)...)
+	}
+
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+func unknownKeys(path, key string, defaults map[string]interface{}, v interface{}) []string {
+	d, ok := defaults[key]
+	if !ok {
+		return []string{path}
+	}
+
+	dm, dok := d.(map[string]interface{})
+	vm, vok := v.(map[string]interface{})
+
+	// Only compare nested values if the default values define the keys of the
+	// map, empty maps allow any key.
+	if !dok || !vok || len(dm) == 0 {
+		return nil
+	}
+
+	var unknown []string
+	for k, nv := range vm {
+		unknown = append(unknown, unknownKeys(path+"."+k, k, dm, nv)...)
+	}
+
+	return unknown
+}
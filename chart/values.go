@@ -0,0 +1,75 @@
+package chart
+
+import (
+	yaml "gopkg.in/yaml.v2"
+	"k8s.io/helm/pkg/chartutil"
+)
+
+// ReadValues parses YAML values into a map.
+func ReadValues(b []byte) (map[string]interface{}, error) {
+	return chartutil.ReadValues(b)
+}
+
+// ToValues converts values parsed as part of the charts configuration into a
+// map, as returned by ReadValues.
+func ToValues(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadValues(b)
+}
+
+// MergeValues deep-merges src into dest, and returns dest. Maps are merged
+// recursively, all other values in src replace those in dest. This matches
+// the way Helm merges multiple values files.
+func MergeValues(dest, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		next, ok := v.(map[string]interface{})
+		if !ok {
+			dest[k] = v
+			continue
+		}
+
+		current, ok := dest[k].(map[string]interface{})
+		if !ok {
+			dest[k] = v
+			continue
+		}
+
+		dest[k] = MergeValues(current, next)
+	}
+
+	return dest
+}
+
+// withoutValues returns the values in vals, without any of the keys in remove.
+// Maps existing in both are compared recursively.
+func withoutValues(vals, remove map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+
+	for k, v := range vals {
+		r, ok := remove[k]
+		if !ok {
+			out[k] = v
+			continue
+		}
+
+		vm, vok := v.(map[string]interface{})
+		rm, rok := r.(map[string]interface{})
+		if !vok || !rok {
+			continue
+		}
+
+		if sub := withoutValues(vm, rm); len(sub) > 0 {
+			out[k] = sub
+		}
+	}
+
+	return out
+}
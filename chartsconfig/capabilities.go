@@ -0,0 +1,68 @@
+package chartsconfig
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/blendle/kubecrt/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/helm/pkg/chartutil"
+	hversion "k8s.io/helm/pkg/version"
+)
+
+var kubeVersion = regexp.MustCompile(`^v?(\d+)\.(\d+)(\.\d+)?$`)
+
+// capabilities returns the capabilities charts are rendered with, based on the
+// configured Kubernetes version and API versions. The API versions served by
+// the Kubernetes version are always available, and a version without bundled
+// schemas is an error. Without either setting, Helm's default capabilities are
+// used.
+func (cc *ChartsConfiguration) capabilities() (*chartutil.Capabilities, error) {
+	if cc.KubeVersion == "" && len(cc.APIVersions) == 0 {
+		return nil, nil
+	}
+
+	caps := &chartutil.Capabilities{
+		APIVersions:   chartutil.NewVersionSet("v1"),
+		KubeVersion:   chartutil.DefaultKubeVersion,
+		TillerVersion: hversion.GetVersionProto(),
+	}
+
+	if cc.KubeVersion != "" {
+		m := kubeVersion.FindStringSubmatch(cc.KubeVersion)
+		if m == nil {
+			return nil, fmt.Errorf("Invalid Kubernetes version %q, please use a version like \"1.24\"", cc.KubeVersion)
+		}
+
+		gitVersion := "v" + m[1] + "." + m[2] + m[3]
+		if m[3] == "" {
+			gitVersion += ".0"
+		}
+
+		caps.KubeVersion = &version.Info{
+			Major:      m[1],
+			Minor:      m[2],
+			GitVersion: gitVersion,
+			GoVersion:  runtime.Version(),
+			Compiler:   runtime.Compiler,
+			Platform:   fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+		}
+
+		served, err := schema.APIVersions(cc.KubeVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range served {
+			caps.APIVersions[v] = struct{}{}
+		}
+	}
+
+	for _, v := range cc.APIVersions {
+		caps.APIVersions[strings.TrimSpace(v)] = struct{}{}
+	}
+
+	return caps, nil
+}
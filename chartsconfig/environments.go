@@ -0,0 +1,106 @@
+package chartsconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/blendle/kubecrt/chart"
+)
+
+// Environment overrides parts of the charts configuration when selected.
+type Environment struct {
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace"`
+	ConfigHash *bool  `yaml:"configHash"`
+
+	// Charts contains the chart overrides, keyed by the name, location, or last
+	// element of the location of the chart they apply to. The version, repo,
+	// name and namespace replace those of the chart, the values are merged
+	// into the chart's values.
+	Charts map[string]*chart.Chart `yaml:"charts"`
+}
+
+// ApplyEnvironment applies the overrides of the selected environment, if any,
+// to the charts configuration.
+func (cc *ChartsConfiguration) ApplyEnvironment() error {
+	env, err := cc.environment()
+	if err != nil || env == nil {
+		return err
+	}
+
+	if env.Name != "" {
+		cc.Name = env.Name
+	}
+
+	if env.Namespace != "" {
+		cc.Namespace = env.Namespace
+	}
+
+	if env.ConfigHash != nil {
+		cc.ConfigHash = env.ConfigHash
+	}
+
+	var refs []string
+	for ref := range env.Charts {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		o := env.Charts[ref]
+		var matched bool
+
+		for _, c := range cc.ChartsList {
+			if !matchesChart(c, ref) {
+				continue
+			}
+			matched = true
+
+			if err = overrideChart(c, o); err != nil {
+				return fmt.Errorf("environment %q: %s", cc.Environment, err)
+			}
+		}
+
+		if !matched {
+			return fmt.Errorf("environment %q: unknown chart %q", cc.Environment, ref)
+		}
+	}
+
+	return nil
+}
+
+// environment returns the selected environment, or nil if no environment is
+// selected.
+func (cc *ChartsConfiguration) environment() (*Environment, error) {
+	if cc.Environment == "" {
+		return nil, nil
+	}
+
+	env, ok := cc.Environments[cc.Environment]
+	if !ok || env == nil {
+		var names []string
+		for n := range cc.Environments {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("Unknown environment %q, available environments: %v", cc.Environment, names)
+	}
+
+	return env, nil
+}
+
+func overrideChart(c, o *chart.Chart) error {
+	if o.Name != "" {
+		c.Name = o.Name
+	}
+
+	return mergeChart(c, o)
+}
+
+// matchesChart returns true if ref is the name, location, or last element of
+// the location of the chart.
+func matchesChart(c *chart.Chart, ref string) bool {
+	return ref == c.Name || ref == c.Location || ref == filepath.Base(c.Location)
+}
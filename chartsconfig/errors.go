@@ -0,0 +1,30 @@
+package chartsconfig
+
+import (
+	"strings"
+
+	"github.com/blendle/kubecrt/chart"
+)
+
+// Errors contains the errors of all charts that failed to render.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Kind returns the kind of the error of the first failed chart.
+func (e Errors) Kind() chart.ErrorKind {
+	for _, err := range e {
+		if ce, ok := err.(*chart.Error); ok {
+			return ce.Kind
+		}
+	}
+
+	return chart.RenderError
+}
@@ -0,0 +1,263 @@
+package chartsconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/blendle/kubecrt/chart"
+)
+
+// resolveIncludes loads the included configuration files, merges them in
+// order, and returns the result with cc merged on top of it.
+func (cc *ChartsConfiguration) resolveIncludes(tpath, dir string, includedBy []string) (*ChartsConfiguration, error) {
+	base := &ChartsConfiguration{}
+
+	for _, inc := range cc.Include {
+		path := inc
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range includedBy {
+			if p == abs {
+				return nil, fmt.Errorf("include cycle detected: %s", strings.Join(append(includedBy, abs), " -> "))
+			}
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read included file: %s", err)
+		}
+
+		m, err := parse(b, tpath, filepath.Dir(path), append(includedBy, abs))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", inc, err)
+		}
+
+		if err = base.Merge(m); err != nil {
+			return nil, fmt.Errorf("%s: %s", inc, err)
+		}
+	}
+
+	if err := base.Merge(cc); err != nil {
+		return nil, err
+	}
+	base.Include = cc.Include
+
+	return base, nil
+}
+
+// Merge merges another charts configuration on top of this one.
+//
+// Top-level settings are replaced by those set in other. Shared values and
+// global values are deep-merged. Charts are matched by their location and
+// name: matching charts are merged, with the version, repo, namespace and hook
+// settings of other replacing the existing ones, and its values deep-merged
+// into the existing values. Charts that do not match any existing chart are
+// appended.
+// Environments are matched by name, and merged the same way.
+//
+// An error is returned if values cannot be merged, because they are not maps.
+func (cc *ChartsConfiguration) Merge(other *ChartsConfiguration) error {
+	var err error
+
+	if other.APIVersion != "" {
+		cc.APIVersion = other.APIVersion
+	}
+
+	if other.Name != "" {
+		cc.Name = other.Name
+	}
+
+	if other.Namespace != "" {
+		cc.Namespace = other.Namespace
+	}
+
+	if other.Order != "" {
+		cc.Order = other.Order
+	}
+
+	if other.Hooks != "" {
+		cc.Hooks = other.Hooks
+	}
+
+	if other.EnforceNamespace != "" {
+		cc.EnforceNamespace = other.EnforceNamespace
+	}
+
+	if other.KubeVersion != "" {
+		cc.KubeVersion = other.KubeVersion
+	}
+
+	if other.APIVersions != nil {
+		cc.APIVersions = other.APIVersions
+	}
+
+	if other.Environment != "" {
+		cc.Environment = other.Environment
+	}
+
+	if other.Offline != nil {
+		cc.Offline = other.Offline
+	}
+
+	if other.ConfigHash != nil {
+		cc.ConfigHash = other.ConfigHash
+	}
+
+	cc.PostRenderers = append(cc.PostRenderers, other.PostRenderers...)
+	cc.CommonLabels = mergeStrings(cc.CommonLabels, other.CommonLabels)
+	cc.CommonAnnotations = mergeStrings(cc.CommonAnnotations, other.CommonAnnotations)
+
+	if cc.Values, err = mergeValues(cc.Values, other.Values); err != nil {
+		return fmt.Errorf("invalid values: %s", err)
+	}
+
+	if cc.Global, err = mergeValues(cc.Global, other.Global); err != nil {
+		return fmt.Errorf("invalid global values: %s", err)
+	}
+
+	for _, oc := range other.ChartsList {
+		if c := cc.chart(oc.Location, oc.Name); c != nil {
+			if err = mergeChart(c, oc); err != nil {
+				return err
+			}
+			continue
+		}
+
+		cc.ChartsList = append(cc.ChartsList, oc)
+	}
+
+	for name, oenv := range other.Environments {
+		if oenv == nil {
+			continue
+		}
+
+		if cc.Environments == nil {
+			cc.Environments = map[string]*Environment{}
+		}
+
+		env, ok := cc.Environments[name]
+		if !ok || env == nil {
+			cc.Environments[name] = oenv
+			continue
+		}
+
+		if oenv.Name != "" {
+			env.Name = oenv.Name
+		}
+
+		if oenv.Namespace != "" {
+			env.Namespace = oenv.Namespace
+		}
+
+		if oenv.ConfigHash != nil {
+			env.ConfigHash = oenv.ConfigHash
+		}
+
+		for ref, oc := range oenv.Charts {
+			if c, ok := env.Charts[ref]; ok {
+				if err = mergeChart(c, oc); err != nil {
+					return fmt.Errorf("environment %q: %s", name, err)
+				}
+				continue
+			}
+
+			if env.Charts == nil {
+				env.Charts = map[string]*chart.Chart{}
+			}
+			env.Charts[ref] = oc
+		}
+	}
+
+	return nil
+}
+
+// chart returns the chart with the given location and name, if any.
+func (cc *ChartsConfiguration) chart(location, name string) *chart.Chart {
+	for _, c := range cc.ChartsList {
+		if c.Location == location && c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func mergeChart(c, o *chart.Chart) error {
+	if o.Namespace != "" {
+		c.Namespace = o.Namespace
+	}
+
+	if o.Version != "" {
+		c.Version = o.Version
+	}
+
+	if o.Repo != "" {
+		c.Repo = o.Repo
+	}
+
+	if o.Hooks != "" {
+		c.Hooks = o.Hooks
+	}
+
+	if o.HookTypes != nil {
+		c.HookTypes = o.HookTypes
+	}
+
+	if o.EnforceNamespace != "" {
+		c.EnforceNamespace = o.EnforceNamespace
+	}
+
+	if o.ConfigHash != nil {
+		c.ConfigHash = o.ConfigHash
+	}
+
+	if o.NameSuffixHash != nil {
+		c.NameSuffixHash = o.NameSuffixHash
+	}
+
+	c.CommonLabels = mergeStrings(c.CommonLabels, o.CommonLabels)
+	c.CommonAnnotations = mergeStrings(c.CommonAnnotations, o.CommonAnnotations)
+	c.PostRenderers = append(c.PostRenderers, o.PostRenderers...)
+	c.Patches = append(c.Patches, o.Patches...)
+
+	vals, err := mergeValues(c.Values, o.Values)
+	if err != nil {
+		return fmt.Errorf("%s: invalid values: %s", c.Location, err)
+	}
+	c.Values = vals
+
+	return nil
+}
+
+// mergeValues deep-merges src into dest. An error is returned if either of
+// them cannot be converted to a map.
+func mergeValues(dest, src interface{}) (interface{}, error) {
+	if src == nil {
+		return dest, nil
+	}
+
+	if dest == nil {
+		return src, nil
+	}
+
+	d, err := chart.ToValues(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := chart.ToValues(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return chart.MergeValues(d, s), nil
+}
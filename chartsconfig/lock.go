@@ -0,0 +1,143 @@
+package chartsconfig
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/blendle/kubecrt/chart"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Lockfile contains the resolved versions of all charts in a charts
+// configuration.
+type Lockfile struct {
+	Charts []*chart.Lock `yaml:"charts"`
+}
+
+// LoadLockfile reads the lockfile at the given path. If the file does not
+// exist, an empty lockfile is returned.
+func LoadLockfile(path string) (*Lockfile, error) {
+	l := &Lockfile{}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(b, l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// WriteFile writes the lockfile to the given path, if its content changed. No
+// file is created if no charts were locked.
+func (l *Lockfile) WriteFile(path string) error {
+	b, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	current, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && len(l.Charts) == 0 {
+		return nil
+	}
+
+	if err == nil && bytes.Equal(current, b) {
+		return nil
+	}
+
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// ApplyLock pins all charts to their locked versions. Charts without a
+// matching entry in the lockfile, for example because their version
+// constraint changed, are resolved again.
+func (cc *ChartsConfiguration) ApplyLock(l *Lockfile) {
+	for _, c := range cc.ChartsList {
+		for _, lc := range l.Charts {
+			if lc.Matches(c) {
+				c.Locked = lc
+				break
+			}
+		}
+	}
+}
+
+// Lockfile returns the lockfile l, with the entries of the charts resolved by
+// ParseCharts replaced by their resolved versions. Entries of configured
+// charts whose version constraint or repository changed are removed. Entries
+// for charts that are not configured, for example because they only apply to
+// another environment, are kept as-is.
+func (cc *ChartsConfiguration) Lockfile(l *Lockfile) *Lockfile {
+	out := &Lockfile{}
+
+	for _, lc := range l.Charts {
+		if cc.stale(lc) {
+			continue
+		}
+
+		if r := cc.resolved(lc); r != nil {
+			lc = r
+		}
+
+		if !out.has(lc) {
+			out.Charts = append(out.Charts, lc)
+		}
+	}
+
+	for _, c := range cc.ChartsList {
+		if c.Resolved != nil && !out.has(c.Resolved) {
+			out.Charts = append(out.Charts, c.Resolved)
+		}
+	}
+
+	return out
+}
+
+// resolved returns the version resolved by ParseCharts for the chart the
+// locked entry belongs to, or nil if no such chart was resolved.
+func (cc *ChartsConfiguration) resolved(lc *chart.Lock) *chart.Lock {
+	for _, c := range cc.ChartsList {
+		if c.Resolved != nil && lc.Matches(c) {
+			return c.Resolved
+		}
+	}
+
+	return nil
+}
+
+// stale returns true if the locked entry has the location of a configured
+// chart, but no configured chart with that location matches its version
+// constraint and repository.
+func (cc *ChartsConfiguration) stale(lc *chart.Lock) bool {
+	var configured bool
+
+	for _, c := range cc.ChartsList {
+		if c.Location != lc.Location {
+			continue
+		}
+
+		if lc.Matches(c) {
+			return false
+		}
+		configured = true
+	}
+
+	return configured
+}
+
+func (l *Lockfile) has(lc *chart.Lock) bool {
+	for _, c := range l.Charts {
+		if *c == *lc {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,63 @@
+package chartsconfig
+
+import (
+	"github.com/blendle/kubecrt/chart"
+	"github.com/blendle/kubecrt/manifest"
+)
+
+// setMetadata adds the common labels and annotations to the resources of a
+// chart. Those of the chart take precedence over the top-level ones.
+func (cc *ChartsConfiguration) setMetadata(c *chart.Chart, ms []*manifest.Manifest) error {
+	labels := mergeStrings(mergeStrings(nil, cc.CommonLabels), c.CommonLabels)
+	annotations := mergeStrings(mergeStrings(nil, cc.CommonAnnotations), c.CommonAnnotations)
+
+	for _, m := range ms {
+		if err := m.SetMetadata(labels, annotations); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setConfigHashes adds the hash of the referenced ConfigMaps and Secrets to
+// the workloads of a chart, if enabled.
+func (cc *ChartsConfiguration) setConfigHashes(c *chart.Chart, ms []*manifest.Manifest) error {
+	if !cc.configHash(c) {
+		return nil
+	}
+
+	return manifest.SetConfigHashes(ms)
+}
+
+// configHash returns whether config hashes are enabled for a chart. The
+// setting of the chart takes precedence over the top-level one, and config
+// hashes are disabled by default.
+func (cc *ChartsConfiguration) configHash(c *chart.Chart) bool {
+	switch {
+	case c.ConfigHash != nil:
+		return *c.ConfigHash
+	case cc.ConfigHash != nil:
+		return *cc.ConfigHash
+	default:
+		return false
+	}
+}
+
+// mergeStrings returns dest, with the keys of src added to it, replacing any
+// existing keys.
+func mergeStrings(dest, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dest
+	}
+
+	if dest == nil {
+		dest = make(map[string]string, len(src))
+	}
+
+	for k, v := range src {
+		dest[k] = v
+	}
+
+	return dest
+}
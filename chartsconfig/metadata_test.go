@@ -0,0 +1,83 @@
+package chartsconfig
+
+import "testing"
+
+func TestConfigHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []string
+		env     string
+		want    []bool
+	}{
+		{
+			name:    "disabled by default",
+			configs: []string{"charts:\n- stable/app: {}\n"},
+			want:    []bool{false},
+		},
+		{
+			name: "disabled by a later file",
+			configs: []string{
+				"configHash: true\ncharts:\n- stable/app: {}\n",
+				"configHash: false\n",
+			},
+			want: []bool{false},
+		},
+		{
+			name: "kept when not set by a later file",
+			configs: []string{
+				"configHash: true\ncharts:\n- stable/app: {}\n",
+				"namespace: apps\n",
+			},
+			want: []bool{true},
+		},
+		{
+			name: "chart setting takes precedence",
+			configs: []string{
+				"configHash: true\ncharts:\n- stable/app: {configHash: true}\n- stable/other: {}\n",
+				"configHash: false\n",
+			},
+			want: []bool{true, false},
+		},
+		{
+			name: "disabled by an environment",
+			configs: []string{
+				"configHash: true\ncharts:\n- stable/app: {}\nenvironments:\n  staging:\n    configHash: false\n",
+			},
+			env:  "staging",
+			want: []bool{false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cc *ChartsConfiguration
+
+			for _, cfg := range tt.configs {
+				c, err := NewChartsConfiguration([]byte(cfg), "", ".")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if cc == nil {
+					cc = c
+					continue
+				}
+
+				if err = cc.Merge(c); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cc.Environment = tt.env
+			if err := cc.ApplyEnvironment(); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, c := range cc.ChartsList {
+				if got := cc.configHash(c); got != tt.want[i] {
+					t.Errorf("%s: got %t, want %t", c.Location, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
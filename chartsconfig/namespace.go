@@ -0,0 +1,71 @@
+package chartsconfig
+
+import (
+	"fmt"
+
+	"github.com/blendle/kubecrt/chart"
+	"github.com/blendle/kubecrt/manifest"
+)
+
+const (
+	// EnforceNamespaceWarn sets the namespace of all namespaced resources that
+	// have none, and warns about resources in a different namespace.
+	EnforceNamespaceWarn = "warn"
+
+	// EnforceNamespaceError sets the namespace of all namespaced resources that
+	// have none, and fails on resources in a different namespace.
+	EnforceNamespaceError = "error"
+)
+
+// enforceNamespace sets the namespace of the chart's namespaced resources that
+// do not have one, and reports the resources with a namespace other than the
+// one the chart is rendered in, according to the chart's enforcement mode.
+func (cc *ChartsConfiguration) enforceNamespace(c *chart.Chart, ms []*manifest.Manifest, clusterScoped map[string]bool) error {
+	mode := cc.EnforceNamespace
+	if c.EnforceNamespace != "" {
+		mode = c.EnforceNamespace
+	}
+
+	if mode == "" {
+		return nil
+	}
+
+	_, namespace := cc.release(c)
+
+	for _, m := range ms {
+		if m.Head.Kind == "" || clusterScoped[m.Head.Kind] {
+			continue
+		}
+
+		ns := m.Head.Metadata.Namespace
+
+		if ns == "" {
+			if err := m.SetNamespace(namespace); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if ns == namespace {
+			continue
+		}
+
+		msg := fmt.Sprintf("%s %s is in namespace %q instead of %q", m.Head.Kind, m.Head.Metadata.Name, ns, namespace)
+		if mode == EnforceNamespaceError {
+			return fmt.Errorf("%s: %s", m.Template, msg)
+		}
+
+		c.Warnings = append(c.Warnings, msg)
+	}
+
+	return nil
+}
+
+func validateEnforceNamespace(mode string) error {
+	switch mode {
+	case "", EnforceNamespaceWarn, EnforceNamespaceError:
+		return nil
+	default:
+		return fmt.Errorf("Unknown enforceNamespace mode %q, please use %q or %q", mode, EnforceNamespaceWarn, EnforceNamespaceError)
+	}
+}
@@ -0,0 +1,57 @@
+package chartsconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/blendle/kubecrt/chart"
+	"github.com/blendle/kubecrt/config"
+	"k8s.io/helm/pkg/strvals"
+)
+
+// ApplyValueOverrides sets the values passed using "--set", "--set-string" and
+// "--set-file" on the charts they apply to, in order. A chart is matched by its
+// name, location, or the last element of its location.
+func (cc *ChartsConfiguration) ApplyValueOverrides(overrides []*config.ValueOverride) error {
+	for _, o := range overrides {
+		var matched bool
+
+		for _, c := range cc.ChartsList {
+			if !matchesChart(c, o.Chart) {
+				continue
+			}
+			matched = true
+
+			vals, err := chart.ToValues(c.Values)
+			if err != nil {
+				return fmt.Errorf("%s: invalid values: %s", c.Location, err)
+			}
+
+			if err = parseOverride(o, vals); err != nil {
+				return fmt.Errorf("--%s %s.%s: %s", o.Type, o.Chart, o.Values, err)
+			}
+
+			c.Values = vals
+		}
+
+		if !matched {
+			return fmt.Errorf("--%s %s.%s: unknown chart %q", o.Type, o.Chart, o.Values, o.Chart)
+		}
+	}
+
+	return nil
+}
+
+func parseOverride(o *config.ValueOverride, vals map[string]interface{}) error {
+	switch o.Type {
+	case config.SetString:
+		return strvals.ParseIntoString(o.Values, vals)
+	case config.SetFile:
+		return strvals.ParseIntoFile(o.Values, vals, func(rs []rune) (interface{}, error) {
+			b, err := ioutil.ReadFile(string(rs))
+			return string(b), err
+		})
+	default:
+		return strvals.ParseInto(o.Values, vals)
+	}
+}
@@ -9,78 +9,243 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/Masterminds/semver"
 	"github.com/blendle/kubecrt/chart"
 	"github.com/blendle/kubecrt/config"
+	"github.com/blendle/kubecrt/manifest"
 	yaml "gopkg.in/yaml.v2"
 	"k8s.io/helm/pkg/engine"
 	hchart "k8s.io/helm/pkg/proto/hapi/chart"
 )
 
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
 // ChartsConfiguration ...
 type ChartsConfiguration struct {
-	APIVersion string                    `yaml:"apiVersion"`
-	Name       string                    `yaml:"name"`
-	Namespace  string                    `yaml:"namespace"`
-	ChartsMap  []map[string]*chart.Chart `yaml:"charts"`
-	ChartsList []*chart.Chart
+	APIVersion        string                    `yaml:"apiVersion"`
+	Name              string                    `yaml:"name"`
+	Namespace         string                    `yaml:"namespace"`
+	Order             string                    `yaml:"order"`
+	Hooks             string                    `yaml:"hooks"`
+	EnforceNamespace  string                    `yaml:"enforceNamespace"`
+	PostRenderers     []*chart.PostRenderer     `yaml:"postRenderers"`
+	KubeVersion       string                    `yaml:"kubeVersion"`
+	APIVersions       []string                  `yaml:"apiVersions"`
+	CommonLabels      map[string]string         `yaml:"commonLabels"`
+	CommonAnnotations map[string]string         `yaml:"commonAnnotations"`
+	ConfigHash        *bool                     `yaml:"configHash"`
+	Offline           *bool                     `yaml:"offline"`
+	Environment       string                    `yaml:"environment"`
+	Environments      map[string]*Environment   `yaml:"environments"`
+	Values            interface{}               `yaml:"values"`
+	Global            interface{}               `yaml:"global"`
+	Include           []string                  `yaml:"include"`
+	ChartsMap         []map[string]*chart.Chart `yaml:"charts"`
+	ChartsList        []*chart.Chart
+}
+
+// NewChartsConfiguration initializes a new ChartsConfiguration. Relative paths
+// in the configuration are resolved against dir.
+//
+// Any files listed under "include" are loaded first, in order, after which the
+// configuration itself is merged on top of them.
+func NewChartsConfiguration(input []byte, tpath, dir string) (*ChartsConfiguration, error) {
+	return parse(input, tpath, dir, nil)
 }
 
-// NewChartsConfiguration initializes a new ChartsConfiguration.
-func NewChartsConfiguration(input []byte, tpath string) (*ChartsConfiguration, error) {
+func parse(input []byte, tpath, dir string, includedBy []string) (*ChartsConfiguration, error) {
 	m := &ChartsConfiguration{}
 
-	renderer := engine.New()
+	out, err := render("charts.yml", input, tpath)
+	if err != nil {
+		return nil, err
+	}
 
-	funcs := template.FuncMap{
-		"env":       func(s string) string { return os.Getenv(s) },
-		"expandenv": func(s string) string { return os.ExpandEnv(s) },
+	if err = yaml.Unmarshal(out, m); err != nil {
+		return nil, wrapError(out, err)
 	}
 
-	for k, v := range funcs {
-		renderer.FuncMap[k] = v
+	for _, a := range m.ChartsMap {
+		var locs []string
+		for loc := range a {
+			locs = append(locs, loc)
+		}
+		sort.Strings(locs)
+
+		for _, loc := range locs {
+			c := a[loc]
+			if c == nil {
+				c = &chart.Chart{}
+			}
+
+			c.Location = loc
+			m.ChartsList = append(m.ChartsList, c)
+		}
+	}
+
+	setPostRenderersDir(m.PostRenderers, dir)
+
+	for _, c := range m.ChartsList {
+		if err = loadValuesFiles(c, tpath, dir); err != nil {
+			return nil, err
+		}
+
+		setPostRenderersDir(c.PostRenderers, dir)
+	}
+
+	for _, env := range m.Environments {
+		if env == nil {
+			continue
+		}
+
+		for ref, c := range env.Charts {
+			if c == nil {
+				c = &chart.Chart{}
+				env.Charts[ref] = c
+			}
+
+			c.Location = ref
+			if err = loadValuesFiles(c, tpath, dir); err != nil {
+				return nil, err
+			}
+
+			setPostRenderersDir(c.PostRenderers, dir)
+		}
+	}
+
+	if len(m.Include) == 0 {
+		return m, nil
+	}
+
+	return m.resolveIncludes(tpath, dir, includedBy)
+}
+
+// ParseCharts renders all charts, and returns the parsed resources. Up to jobs
+// charts are rendered concurrently. If any of the charts fail to render, an
+// Errors value is returned, containing a *chart.Error for each failed chart.
+//
+// Resources are returned in the configured order. By default, the charts are
+// kept in the order they are configured in, with each chart's resources
+// ordered by template path. When ordering by kind, the resources of all charts
+// are sorted using Helm's install order. In both cases, hooks that run before
+// installing a release are moved to the front, and all other hooks to the end.
+func (cc *ChartsConfiguration) ParseCharts(jobs int) ([]*manifest.Manifest, error) {
+	if jobs < 1 {
+		jobs = 1
 	}
 
-	t, err := stubChart(input, tpath)
+	caps, err := cc.capabilities()
 	if err != nil {
-		return nil, err
+		return nil, &chart.Error{Kind: chart.ConfigError, Err: err}
 	}
 
-	tpls, err := renderer.Render(t, map[string]interface{}{})
+	patcher, err := cc.patcher()
 	if err != nil {
-		return nil, err
+		return nil, &chart.Error{Kind: chart.ConfigError, Err: err}
 	}
 
-	out := []byte(tpls["kubecrt/charts.yml"])
+	resources := make([][]*manifest.Manifest, len(cc.ChartsList))
+	errs := make([]error, len(cc.ChartsList))
 
-	if err = yaml.Unmarshal(out, m); err != nil {
-		return nil, wrapError(out, err)
+	var wg sync.WaitGroup
+	queue := make(chan int)
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				c := cc.ChartsList[i]
+				name, namespace := cc.release(c)
+
+				if errs[i] = c.WrapError(chart.ConfigError, cc.mergeSharedValues(c)); errs[i] != nil {
+					continue
+				}
+
+				c.Capabilities = caps
+
+				resources[i], errs[i] = c.ParseChart(name, namespace)
+				if errs[i] != nil {
+					continue
+				}
+
+				resources[i] = manifest.FilterHooks(resources[i], cc.hooks(c), c.HookTypes)
+
+				if errs[i] = applyPatches(c, namespace, resources[i], patcher); errs[i] != nil {
+					continue
+				}
+
+				if errs[i] = cc.setMetadata(c, resources[i]); errs[i] != nil {
+					continue
+				}
+
+				if resources[i], errs[i] = cc.postRender(c, resources[i]); errs[i] != nil {
+					continue
+				}
+
+				if c.NameSuffixHash != nil && *c.NameSuffixHash {
+					if errs[i] = manifest.SetNameSuffixHashes(resources[i]); errs[i] != nil {
+						continue
+					}
+				}
+
+				if errs[i] = cc.setConfigHashes(c, resources[i]); errs[i] != nil {
+					continue
+				}
+
+				if cc.Order != manifest.KindOrder {
+					manifest.SortHooks(resources[i])
+				}
+			}
+		}()
 	}
 
-	for _, a := range m.ChartsMap {
-		for loc, c := range a {
-			c.Location = loc
-			m.ChartsList = append(m.ChartsList, c)
-		}
+	for i := range cc.ChartsList {
+		queue <- i
 	}
+	close(queue)
+	wg.Wait()
 
-	return m, nil
-}
+	var all []*manifest.Manifest
+	for i := range resources {
+		all = append(all, resources[i]...)
+	}
+
+	clusterScoped, err := manifest.ClusterScopedKinds(all)
+	if err != nil {
+		return nil, &chart.Error{Kind: chart.RenderError, Err: err}
+	}
 
-// ParseCharts loops through all charts, and returns the parsed resources.
-func (cc *ChartsConfiguration) ParseCharts() ([]byte, error) {
-	var out []byte
+	var out []*manifest.Manifest
+	var failed Errors
 
-	for _, c := range cc.ChartsList {
-		resources, err := c.ParseChart(cc.Name, cc.Namespace)
-		if err != nil {
-			return nil, err
+	for i, c := range cc.ChartsList {
+		if errs[i] == nil {
+			errs[i] = c.WrapError(chart.ValidationError, cc.enforceNamespace(c, resources[i], clusterScoped))
 		}
 
-		out = append(out, resources...)
+		if errs[i] != nil {
+			failed = append(failed, c.WrapError(chart.RenderError, errs[i]))
+			continue
+		}
+
+		out = append(out, resources[i]...)
+	}
+
+	if len(failed) > 0 {
+		return nil, failed
+	}
+
+	if cc.Order == manifest.KindOrder {
+		manifest.SortByKind(out)
+		manifest.SortHooks(out)
 	}
 
 	return out, nil
@@ -96,35 +261,145 @@ func (cc *ChartsConfiguration) Validate() error {
 		return errors.New("Unknown API version, please set apiVersion to \"v1\"")
 	}
 
-	if cc.Name == "" {
-		return errors.New("Missing name, please add \"name: my-app-name\" or pass \"--name=my-app-name\"")
+	if _, err := cc.environment(); err != nil {
+		return err
+	}
+
+	switch cc.Order {
+	case "", manifest.TemplateOrder, manifest.KindOrder:
+	default:
+		return fmt.Errorf("Unknown order %q, please use %q or %q", cc.Order, manifest.TemplateOrder, manifest.KindOrder)
+	}
+
+	if err := manifest.ValidateHooks(cc.Hooks, nil); err != nil {
+		return err
+	}
+
+	if err := validateEnforceNamespace(cc.EnforceNamespace); err != nil {
+		return err
 	}
 
-	if cc.Namespace == "" {
-		return errors.New("Missing namespace, please add \"namespace: my-namespace\" or pass \"--namespace=my-namespace\"")
+	if _, err := cc.capabilities(); err != nil {
+		return err
 	}
 
 	if len(cc.ChartsList) == 0 {
 		return errors.New("Missing charts, you need to define at least one chart")
 	}
 
+	releases := map[string]bool{}
+
 	for _, c := range cc.ChartsList {
 		if c.Location == "" {
 			return errors.New("Invalid or missing chart name")
 		}
 
+		name, namespace := cc.release(c)
+
+		if name == "" {
+			return errors.New("Missing name, please add \"name: my-app-name\" or pass \"--name=my-app-name\"")
+		}
+
+		if namespace == "" {
+			return errors.New("Missing namespace, please add \"namespace: my-namespace\" or pass \"--namespace=my-namespace\"")
+		}
+
+		if c.Name != "" && !dnsLabel.MatchString(c.Name) {
+			return fmt.Errorf("%s: invalid name %q, must be a lowercase RFC 1123 label", c.Location, c.Name)
+		}
+
+		if c.Namespace != "" && !dnsLabel.MatchString(c.Namespace) {
+			return fmt.Errorf("%s: invalid namespace %q, must be a lowercase RFC 1123 label", c.Location, c.Namespace)
+		}
+
+		release := c.Location + "/" + namespace + "/" + name
+		if releases[release] {
+			return fmt.Errorf("%s: chart is defined multiple times with name %q in namespace %q, please set a unique \"name\" for each", c.Location, name, namespace)
+		}
+		releases[release] = true
+
 		if c.Version != "" {
 			if _, err := semver.NewConstraint(c.Version); err != nil {
 				return errors.New(c.Version + ": " + err.Error())
 			}
 		}
+
+		if err := manifest.ValidateHooks(c.Hooks, c.HookTypes); err != nil {
+			return fmt.Errorf("%s: %s", c.Location, err)
+		}
+
+		if err := validateEnforceNamespace(c.EnforceNamespace); err != nil {
+			return fmt.Errorf("%s: %s", c.Location, err)
+		}
+
+		for i, p := range c.Patches {
+			if err := p.Validate(); err != nil {
+				return fmt.Errorf("%s: patch %d: %s", c.Location, i+1, err)
+			}
+		}
 	}
 
 	return nil
 }
 
-func stubChart(b []byte, partialPath string) (*hchart.Chart, error) {
-	tpls, err := loadTemplates(b, partialPath)
+// release returns the release name and namespace used to render a chart. The
+// chart's own name and namespace take precedence over the top-level ones.
+func (cc *ChartsConfiguration) release(c *chart.Chart) (string, string) {
+	name, namespace := cc.Name, cc.Namespace
+
+	if c.Name != "" {
+		name = c.Name
+	}
+
+	if c.Namespace != "" {
+		namespace = c.Namespace
+	}
+
+	return name, namespace
+}
+
+// hooks returns the hook policy of a chart, which defaults to the top-level
+// policy, and to including all hooks.
+func (cc *ChartsConfiguration) hooks(c *chart.Chart) string {
+	switch {
+	case c.Hooks != "":
+		return c.Hooks
+	case cc.Hooks != "":
+		return cc.Hooks
+	default:
+		return manifest.HooksInclude
+	}
+}
+
+// render renders the named template, using the same functions and partial
+// templates as available in the charts configuration.
+func render(name string, b []byte, tpath string) ([]byte, error) {
+	renderer := engine.New()
+
+	funcs := template.FuncMap{
+		"env":       func(s string) string { return os.Getenv(s) },
+		"expandenv": func(s string) string { return os.ExpandEnv(s) },
+	}
+
+	for k, v := range funcs {
+		renderer.FuncMap[k] = v
+	}
+
+	t, err := stubChart(name, b, tpath)
+	if err != nil {
+		return nil, err
+	}
+
+	tpls, err := renderer.Render(t, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(tpls["kubecrt/"+name]), nil
+}
+
+func stubChart(name string, b []byte, partialPath string) (*hchart.Chart, error) {
+	tpls, err := loadTemplates(name, b, partialPath)
 	if err != nil {
 		return nil, err
 	}
@@ -139,8 +414,8 @@ func stubChart(b []byte, partialPath string) (*hchart.Chart, error) {
 	return chart, nil
 }
 
-func loadTemplates(b []byte, partialPath string) ([]*hchart.Template, error) {
-	tpls := []*hchart.Template{{Data: b, Name: "charts.yml"}}
+func loadTemplates(name string, b []byte, partialPath string) ([]*hchart.Template, error) {
+	tpls := []*hchart.Template{{Data: b, Name: name}}
 
 	if partialPath == config.DefaultPartialTemplatesPath {
 		if _, err := os.Stat(partialPath); os.IsNotExist(err) {
@@ -0,0 +1,41 @@
+package chartsconfig
+
+import (
+	"fmt"
+
+	"github.com/blendle/kubecrt/chart"
+	"github.com/blendle/kubecrt/manifest"
+	"github.com/blendle/kubecrt/schema"
+)
+
+// patcher returns the patcher used to apply strategic merge patches, or nil if
+// none of the charts have patches. The patch strategies of the configured
+// Kubernetes version are used, or those of the newest bundled version, if no
+// version is configured.
+func (cc *ChartsConfiguration) patcher() (*schema.Patcher, error) {
+	for _, c := range cc.ChartsList {
+		if len(c.Patches) == 0 {
+			continue
+		}
+
+		p, err := schema.NewPatcher(cc.KubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("unable to apply patches: %s", err)
+		}
+
+		return p, nil
+	}
+
+	return nil, nil
+}
+
+// applyPatches applies the patches of a chart, in order, to its resources.
+func applyPatches(c *chart.Chart, namespace string, ms []*manifest.Manifest, p *schema.Patcher) error {
+	for i, patch := range c.Patches {
+		if err := patch.Apply(ms, namespace, p); err != nil {
+			return fmt.Errorf("patch %d: %s", i+1, err)
+		}
+	}
+
+	return nil
+}
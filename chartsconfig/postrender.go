@@ -0,0 +1,28 @@
+package chartsconfig
+
+import (
+	"github.com/blendle/kubecrt/chart"
+	"github.com/blendle/kubecrt/manifest"
+)
+
+// postRender passes the resources of a chart through the chart's
+// post-renderers, followed by the top-level post-renderers, in order.
+func (cc *ChartsConfiguration) postRender(c *chart.Chart, ms []*manifest.Manifest) ([]*manifest.Manifest, error) {
+	var err error
+
+	for _, p := range append(append([]*chart.PostRenderer{}, c.PostRenderers...), cc.PostRenderers...) {
+		if ms, err = p.Run(ms); err != nil {
+			return nil, err
+		}
+	}
+
+	return ms, nil
+}
+
+// setPostRenderersDir sets the directory post-renderers are run in to the
+// directory of the charts configuration file that defines them.
+func setPostRenderersDir(ps []*chart.PostRenderer, dir string) {
+	for _, p := range ps {
+		p.Dir = dir
+	}
+}
@@ -0,0 +1,96 @@
+package chartsconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/blendle/kubecrt/chart"
+	"k8s.io/helm/pkg/chartutil"
+)
+
+// loadValuesFiles merges the chart's values files, in order, followed by its
+// inline values, into the chart's values. Values files are rendered as
+// templates, the same way as the charts configuration is.
+func loadValuesFiles(c *chart.Chart, tpath, dir string) error {
+	if len(c.ValuesFiles) == 0 {
+		return nil
+	}
+
+	vals := map[string]interface{}{}
+
+	for _, f := range c.ValuesFiles {
+		path := f
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: unable to read values file: %s", c.Location, err)
+		}
+
+		out, err := render(filepath.Base(path), b, tpath)
+		if err != nil {
+			return fmt.Errorf("%s: unable to render values file %s: %s", c.Location, f, err)
+		}
+
+		v, err := chart.ReadValues(out)
+		if err != nil {
+			return fmt.Errorf("%s: unable to parse values file %s: %s", c.Location, f, wrapError(out, err))
+		}
+
+		vals = chart.MergeValues(vals, v)
+	}
+
+	inline, err := chart.ToValues(c.Values)
+	if err != nil {
+		return fmt.Errorf("%s: invalid values: %s", c.Location, err)
+	}
+
+	c.Values = chart.MergeValues(vals, inline)
+
+	return nil
+}
+
+// mergeSharedValues merges the chart's values on top of the values shared by
+// all charts. The shared global values are available to the chart, and its
+// subcharts, as ".Values.global".
+func (cc *ChartsConfiguration) mergeSharedValues(c *chart.Chart) error {
+	if cc.Values == nil && cc.Global == nil {
+		return nil
+	}
+
+	vals, err := chart.ToValues(cc.Values)
+	if err != nil {
+		return fmt.Errorf("invalid values: %s", err)
+	}
+
+	if cc.Global != nil {
+		global, err := chart.ToValues(cc.Global)
+		if err != nil {
+			return fmt.Errorf("invalid global values: %s", err)
+		}
+
+		current, _ := vals[chartutil.GlobalKey].(map[string]interface{})
+		if current == nil {
+			current = map[string]interface{}{}
+		}
+
+		vals[chartutil.GlobalKey] = chart.MergeValues(current, global)
+	}
+
+	cvals, err := chart.ToValues(c.Values)
+	if err != nil {
+		return fmt.Errorf("%s: invalid values: %s", c.Location, err)
+	}
+
+	c.SharedValues, err = chart.ToValues(vals)
+	if err != nil {
+		return err
+	}
+
+	c.Values = chart.MergeValues(vals, cvals)
+
+	return nil
+}
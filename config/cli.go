@@ -21,16 +21,33 @@ Doing this, you can use Kubernetes charts, without
 having to use Helm locally, or Tiller on the server.
 
 Usage:
-  kubecrt [options] CHARTS_CONFIG
+  kubecrt diff [options] [--set=VALUES]... [--set-string=VALUES]... [--set-file=VALUES]... OLD NEW
+  kubecrt [options] [--set=VALUES]... [--set-string=VALUES]... [--set-file=VALUES]... CHARTS_CONFIG...
   kubecrt -h | --help
   kubecrt --version
   kubecrt --example-config
 
 Where CHARTS_CONFIG is the location of the YAML file
-containing the Kubernetes Charts configuration.
+containing the Kubernetes Charts configuration. When
+multiple files are given, they are merged in order.
+
+The diff command renders two charts configurations,
+and prints the differences between the resources of
+both, matched by apiVersion, kind, namespace and name.
+Either side can also be a file or directory containing
+previously rendered resources. It exits with status 1
+if there are any differences, and 2 or higher on errors.
+
+Using --live, OLD is a snapshot of the live objects in
+a cluster instead, as exported by "kubectl get -o yaml",
+and the drift between the cluster and NEW is printed.
 
 Arguments:
   CHARTS_CONFIG                    Charts configuration file
+  OLD                              Charts configuration file, or resources file
+                                   or directory, to compare against
+  NEW                              Charts configuration file, or resources file
+                                   or directory, to compare
 
 Options:
   -h, --help                       Show this screen
@@ -39,11 +56,63 @@ Options:
                                    used by charts during compilation
   -a NAME, --name=NAME             Set the .Release.Name chart variable, used by
                                    charts during compilation
+  -e ENV, --env=ENV                Select an environment from the charts
+                                   configuration, overriding its values
   -o PATH, --output=PATH           Write output to a file, instead of STDOUT
+  -d DIR, --output-dir=DIR         Write each resource to a separate file in DIR,
+                                   instead of STDOUT. Files written to DIR in
+                                   a previous run, but not in this one, are
+                                   removed
+  --output-layout=TEMPLATE         Template used to determine the path of each
+                                   resource within the output directory. Supports
+                                   .Chart, .Release, .Template, .APIVersion,
+                                   .Kind, .Name and .Namespace. Resources with
+                                   the same path are written to the same file
+                                   [default: {{ .Release }}/{{ .Chart }}/{{ lower .Kind }}-{{ .Name }}.yaml]
   -r NAME=URL, --repo=NAME=URL,... List of NAME=URL pairs of repositories to add
                                    to the index before compiling charts config
+  --set=VALUES                     Set values of a chart, using CHART.KEY=VALUE.
+                                   CHART is the name of the chart, or the last
+                                   element of its location. Can be repeated, and
+                                   multiple comma-separated KEY=VALUE pairs can
+                                   be set for the same chart
+  --set-string=VALUES              Same as "--set", but always set STRING values
+  --set-file=VALUES                Same as "--set", but set the values to the
+                                   contents of the file at path VALUE
   -p DIR, --partials-dir=DIR       Path from which to load partial templates
                                    [default: config/deploy/partials]
+  --jobs=N                         Number of charts to download and render
+                                   concurrently [default: 4]
+  --offline                        Never access the network, only use the charts
+                                   and repository indexes cached in the Helm
+                                   home directory
+  --update-lock                    Resolve all chart version constraints again,
+                                   instead of using the versions stored in the
+                                   charts.lock file next to CHARTS_CONFIG
+  --state=FILE                     Record the resources rendered in FILE, and
+                                   report the resources recorded by the previous
+                                   run that are no longer rendered
+  --prune-output=FILE              Write the resources that are no longer
+                                   rendered to FILE, to be deleted using
+                                   "kubectl delete -f FILE", instead of listing
+                                   them on STDERR. Requires --state
+  --order=ORDER                    Order of the resources in the output, either
+                                   "template" (by chart template path) or "kind"
+                                   (Helm's install order by resource kind)
+  --validate                       Validate the resources against the schemas of
+                                   the Kubernetes version set by --kube-version,
+                                   instead of printing them, if invalid
+  --kube-version=VERSION           Kubernetes version to render charts for, and
+                                   to validate against. Validation defaults to
+                                   the newest supported version
+  --api-versions=VERSIONS          Comma-separated list of additional API
+                                   versions available to charts through
+                                   .Capabilities.APIVersions
+  --schema-dir=DIR                 Path from which to load the custom resource
+                                   definitions used to validate custom resources
+  --live                           Compare NEW against a snapshot of live objects
+                                   in OLD, ignoring fields populated by the API
+                                   server, and reporting orphaned objects
   -j, --json                       Print resources formatted as JSON instead of
                                    YAML. Each resource is printed on a single
                                    line.
@@ -53,7 +122,7 @@ Options:
 
 // CLI returns the parsed command-line arguments
 func CLI() map[string]interface{} {
-	arguments, err := docopt.Parse(usage, nil, true, "kubecrt "+version+" ("+gitrev+")", true)
+	arguments, err := docopt.Parse(usage, nil, true, "kubecrt "+version+" ("+gitrev+")", false)
 	if err != nil {
 		panic(err)
 	}
@@ -67,7 +136,7 @@ func CLI() map[string]interface{} {
 }
 
 func generateExampleConfig() {
-	fmt.Println(docs)
+	fmt.Print(docs)
 }
 
 const docs = `
@@ -77,16 +146,113 @@ apiVersion: v1
 
 # name is the .Release.Name template value that charts can use in their
 # templates, which can be overridden by the "--name" CLI flag. If omitted,
-# "--name" is required.
+# "--name" is required, unless all charts define their own name.
 name: my-bundled-apps
 
 # namespace is the .Release.Namespace template value that charts can use in
 # their templates. Note that since kubecrt does not communicate with
 # Kubernetes in any way, it is up to you to also use this namespace when
 # doing kubectl apply [...]. Can be overridden using "--namespace".  If omitted,
-# "--namespace" is required.
+# "--namespace" is required, unless all charts define their own namespace.
 namespace: apps
 
+# enforceNamespace sets the namespace of all namespaced resources that do not
+# define one to the namespace the chart is rendered in, so the output does not
+# depend on the namespace kubectl uses. Resources in another namespace are
+# reported as a warning ("warn") or an error ("error"). Cluster-scoped
+# resources, including custom resources defined as cluster-scoped by a custom
+# resource definition in the output, are left untouched. Can be set per chart
+# as well. Disabled by default.
+enforceNamespace: warn
+
+# order defines the order of the resources in the output. By default
+# ("template"), charts are kept in the order listed below, and each chart's
+# resources are ordered by their template path. Using "kind", resources of all
+# charts are ordered by Helm's install order (Namespace, ResourceQuota, ...,
+# ConfigMap, ..., Deployment, ...). Can be overridden using "--order".
+order: template
+
+# kubeVersion is the Kubernetes version charts are rendered for, available as
+# ".Capabilities.KubeVersion". The API versions served by this version are
+# available through ".Capabilities.APIVersions.Has", and it is the version
+# resources are validated against using "--validate". Must be a version with
+# bundled schemas, 1.19 to 1.28. Can be overridden using "--kube-version".
+kubeVersion: "1.24"
+
+# apiVersions are additional API versions available to charts through
+# ".Capabilities.APIVersions", such as those of custom resources. Additional
+# versions can be passed using "--api-versions".
+apiVersions:
+- monitoring.coreos.com/v1
+
+# commonLabels and commonAnnotations are added to the metadata of every
+# resource, and to the pod template metadata of workloads (Deployment,
+# StatefulSet, DaemonSet, Job, CronJob, ...), replacing any labels or
+# annotations with the same keys. Selectors are never changed. Charts can
+# define their own commonLabels and commonAnnotations, which are merged with,
+# and take precedence over, the top-level ones.
+commonLabels:
+  app.kubernetes.io/managed-by: kubecrt
+commonAnnotations:
+  example.com/git-sha: {{ env "GIT_SHA" | quote }}
+
+# configHash adds a "kubecrt/config-hash" annotation to the pod templates of
+# all Deployments, StatefulSets and DaemonSets, containing a hash of the data
+# of the ConfigMaps and Secrets of the same chart they reference through
+# volumes, envFrom or env. Any change to that data rolls out the workload,
+# even if the chart itself does not add "checksum/config" annotations. Can be
+# enabled or disabled per chart, per environment, or by a later configuration
+# file as well, with the setting of the chart taking precedence. Disabled by
+# default.
+configHash: true
+
+# postRenderers is a list of commands that modify the rendered resources of
+# each chart. Every command receives the resources of a chart as YAML on
+# stdin, and has to print the resulting resources as YAML to stdout. The
+# post-renderers of a chart run first, followed by these, in order. Commands
+# are run in the directory of this file, and can be given as a path relative to
+# it, or as a map with the command and its arguments.
+postRenderers:
+- ./hack/post-render.sh
+- command: sed
+  args: ["s/registry.example.com/registry.example.org/"]
+
+# hooks defines how resources annotated as Helm hooks ("helm.sh/hook") are
+# handled: "include" (the default) renders them along with all other
+# resources, "exclude" leaves them out, and "only" renders nothing but the
+# hooks. Included hooks that run before a release is installed or upgraded
+# (pre-install, pre-upgrade and crd-install) are printed before all other
+# resources, all other hooks after them, ordered by their "helm.sh/hook-weight".
+# Can be set per chart as well.
+hooks: include
+
+# offline prevents kubecrt from accessing the network. Repository indexes are
+# not updated, and charts are only loaded from the Helm home cache. Can be
+# enabled using "--offline".
+offline: false
+
+# include is a list of charts configuration files, relative to this file, that
+# this file extends. Included files are merged in order, followed by this file.
+# Top-level settings of later files take precedence, "values" and "global" are
+# merged, and charts with the same location and name are merged (versions and
+# repos are replaced, values are merged, and values files are appended), other
+# charts are added to the list. The same rules apply when passing multiple
+# files on the command line.
+include:
+- ../base/charts.yml
+
+# values are shared by all charts. They are merged into the values of each
+# chart, with the values of the chart taking precedence.
+values:
+  image:
+    registry: registry.example.com
+
+# global values are available to all charts, and their subcharts, as
+# ".Values.global", the same way as in Helm umbrella charts.
+global:
+  podAnnotations:
+    team: platform
+
 # charts is an array of charts you want to compile into Kubernetes resource
 # files.
 #
@@ -118,13 +284,76 @@ charts:
         name: {{ env "MY_SERVER_NAME" | default "hello world!" }}
 
 - stable/minecraft:
-    # version is a semantic version constraint.
+    # version is a semantic version constraint. The version it resolves to is
+    # stored in the "charts.lock" file next to this file, and used on
+    # subsequent runs, until the constraint changes, or "--update-lock" is
+    # used.
     #
     # see: https://github.com/Masterminds/semver#basic-comparisons
     version: ~> 0.1.0
     values:
       minecraftServer:
         difficulty: hard
+    # valuesFiles is a list of values files, relative to this file. The files
+    # are merged in order, followed by the "values" above, the same way as
+    # multiple "--values" files are merged by Helm. Values files support the
+    # same templating as this file does.
+    valuesFiles:
+    - values/minecraft.yml
+    - values/minecraft-{{ env "ENVIRONMENT" | default "staging" }}.yml
+
+- stable/redis:
+    # name and namespace override the top-level "name" and "namespace" values
+    # for this chart only. This allows you to render multiple releases of the
+    # same chart, or to spread charts across namespaces.
+    name: cache
+    namespace: cache
+    # hooks overrides the top-level hooks policy for this chart. hookTypes
+    # limits the hooks that are rendered to the listed types, e.g.
+    # "pre-install" or "test-success".
+    hooks: include
+    hookTypes: [pre-install, pre-upgrade]
+    # nameSuffixHash appends a hash of their data to the names of the
+    # ConfigMaps and Secrets of this chart, e.g. "cache-redis-5f7c2a9b1e", and
+    # updates all references to them in the pod specs of the chart's workloads
+    # (volumes, envFrom, env and imagePullSecrets), in its Ingresses, in the
+    # secrets and imagePullSecrets of its ServiceAccounts, and in the
+    # resourceNames of its Roles and ClusterRoles. References from other
+    # charts, or in any other fields, are not updated. Any change to the data
+    # thereby creates a new ConfigMap or Secret, rolling out the workloads
+    # atomically, while the previous ones remain available for a rollback.
+    # Disabled by default, and can be disabled again by an environment or
+    # another configuration file.
+    nameSuffixHash: true
+    # patches modify the rendered resources of this chart, without having to
+    # fork it. A patch is either a strategic merge patch (a map), the same as
+    # used by "kubectl patch", or a JSON 6902 patch (a list of operations).
+    # The target selects the resources to patch by group, version, kind, name,
+    # namespace and labelSelector. Strategic merge patches without a target
+    # apply to the resource with the apiVersion, kind and name in the patch,
+    # and require the kind and name to be set.
+    # A patch that does not match any resource is an error.
+    patches:
+    - patch:
+        apiVersion: apps/v1
+        kind: StatefulSet
+        metadata:
+          name: cache-redis-master
+        spec:
+          template:
+            spec:
+              containers:
+              - name: cache-redis
+                resources:
+                  limits:
+                    memory: 512Mi
+    - target:
+        kind: Service
+        labelSelector: app=redis
+      patch: |
+        - op: add
+          path: /metadata/annotations/example.com~1team
+          value: platform
 
 - opsgoodness/prometheus-operator:
     # repo is the location of a repositry, if other than "stable". This is
@@ -138,4 +367,28 @@ charts:
 #   * stable/factorio: https://git.io/v9Tyr
 #   * stable/minecraft: https://git.io/v9Tya
 #   * opsgoodness/prometheus-operator: https://git.io/v9SAY
+
+# environments defines overrides for specific environments, such as
+# "production" or "staging". An environment is selected using the top-level
+# "environment" key, or "--env", which takes precedence. Selecting an
+# environment that is not defined is an error.
+environment: staging
+
+environments:
+  production:
+    # name, namespace and configHash override the top-level "name",
+    # "namespace" and "configHash".
+    namespace: apps-production
+
+    # charts overrides the configuration of charts, referenced by their name,
+    # location, or the last element of their location. The version, repo,
+    # name and namespace replace those of the chart, while values and
+    # valuesFiles are merged into the chart's values.
+    charts:
+      stable/minecraft:
+        version: ~> 0.2.0
+        values:
+          minecraftServer:
+            difficulty: hardcore
+  staging: {}
 `
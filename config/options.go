@@ -1,47 +1,210 @@
 package config
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/helm/pkg/strvals"
+)
 
 // DefaultPartialTemplatesPath is the default path used for partials.
 const DefaultPartialTemplatesPath = "config/deploy/partials"
 
+// LockfileName is the name of the file in which the resolved chart versions
+// are stored, next to the charts configuration file.
+const LockfileName = "charts.lock"
+
+const (
+	// SetValue is the type of a "--set" value override.
+	SetValue = "set"
+
+	// SetString is the type of a "--set-string" value override.
+	SetString = "set-string"
+
+	// SetFile is the type of a "--set-file" value override.
+	SetFile = "set-file"
+)
+
 // CLIOptions contains all the options set through the CLI arguments
 type CLIOptions struct {
-	ChartsConfigurationPath    string
+	ChartsConfigurationPaths   []string
+	Diff                       bool
+	DiffOld                    string
+	DiffNew                    string
+	DiffLive                   bool
+	Repositories               []*Repository
 	PartialTemplatesPath       string
 	ChartsConfigurationOptions *ChartsConfigurationOptions
+	OutputDir                  string
+	OutputLayout               string
+	LockfilePath               string
+	UpdateLock                 bool
+	StatePath                  string
+	PruneOutput                string
 	OutputJSON                 bool
+	Offline                    bool
+	Jobs                       int
+	Validate                   bool
+	KubeVersion                string
+	APIVersions                []string
+	SchemaDir                  string
 }
 
 // ChartsConfigurationOptions contains the CLI options relevant for the charts
 // configuration.
 type ChartsConfigurationOptions struct {
-	Name      string
-	Namespace string
+	Name        string
+	Namespace   string
+	Order       string
+	Environment string
+	Values      []*ValueOverride
+}
+
+// Repository is a chart repository set through the "--repo" CLI argument.
+type Repository struct {
+	Name string
+	URL  string
+}
+
+// ValueOverride contains the values set for a chart through the "--set",
+// "--set-string" and "--set-file" CLI arguments.
+type ValueOverride struct {
+	// Type is the type of override, one of SetValue, SetString or SetFile.
+	Type string
+
+	// Chart is the name of the chart the values apply to.
+	Chart string
+
+	// Values are the KEY=VALUE pairs, in Helm's "--set" format.
+	Values string
 }
 
 // NewCLIOptions takes CLI arguments, and returns a CLIOptions struct.
 func NewCLIOptions(cli map[string]interface{}) (*CLIOptions, error) {
-	path, ok := cli["CHARTS_CONFIG"].(string)
-	if !ok {
+	diff, _ := cli["diff"].(bool)
+
+	paths, ok := cli["CHARTS_CONFIG"].([]string)
+	if !diff && (!ok || len(paths) == 0) {
 		return nil, errors.New("Invalid argument: CHARTS_CONFIG")
 	}
 
+	// The lockfile is stored next to the last, most specific, configuration.
+	// A configuration read from stdin has no such location, so its charts are
+	// not locked.
+	var path string
+	if len(paths) > 0 {
+		path = paths[len(paths)-1]
+	}
+
+	var lockPath string
+	if path != "" && path != "-" {
+		lockPath = filepath.Join(filepath.Dir(path), LockfileName)
+	}
+
 	name, _ := cli["--name"].(string)
 	namespace, _ := cli["--namespace"].(string)
+	order, _ := cli["--order"].(string)
+	env, _ := cli["--env"].(string)
 
 	c := &CLIOptions{
-		OutputJSON:              cli["--json"].(bool),
-		ChartsConfigurationPath: path,
+		OutputJSON:               cli["--json"].(bool),
+		Offline:                  cli["--offline"].(bool),
+		ChartsConfigurationPaths: paths,
+		LockfilePath:             lockPath,
+		UpdateLock:               cli["--update-lock"].(bool),
 		ChartsConfigurationOptions: &ChartsConfigurationOptions{
-			Name:      name,
-			Namespace: namespace,
+			Name:        name,
+			Namespace:   namespace,
+			Order:       order,
+			Environment: env,
 		},
 	}
 
+	c.Diff = diff
+	c.DiffOld, _ = cli["OLD"].(string)
+	c.DiffNew, _ = cli["NEW"].(string)
+	c.DiffLive, _ = cli["--live"].(bool)
+
+	if cli["--repo"] != nil {
+		for _, r := range strings.Split(cli["--repo"].(string), ",") {
+			p := strings.SplitN(r, "=", 2)
+			if len(p) != 2 {
+				return nil, fmt.Errorf("Invalid argument: --repo=%s, must be in the format NAME=URL", cli["--repo"])
+			}
+
+			c.Repositories = append(c.Repositories, &Repository{
+				Name: strings.TrimSpace(p[0]),
+				URL:  strings.TrimSpace(p[1]),
+			})
+		}
+	}
+
+	c.Validate = cli["--validate"].(bool)
+	c.KubeVersion, _ = cli["--kube-version"].(string)
+	c.SchemaDir, _ = cli["--schema-dir"].(string)
+
+	if cli["--api-versions"] != nil {
+		for _, v := range strings.Split(cli["--api-versions"].(string), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				c.APIVersions = append(c.APIVersions, v)
+			}
+		}
+	}
+
+	jobs, err := strconv.Atoi(cli["--jobs"].(string))
+	if err != nil || jobs < 1 {
+		return nil, fmt.Errorf("Invalid argument: --jobs=%s, must be a positive number", cli["--jobs"])
+	}
+	c.Jobs = jobs
+
+	if cli["--output-dir"] != nil {
+		if cli["--output"] != nil || c.OutputJSON {
+			return nil, errors.New("Invalid argument: --output-dir cannot be combined with --output or --json")
+		}
+
+		c.OutputDir, _ = cli["--output-dir"].(string)
+		c.OutputLayout, _ = cli["--output-layout"].(string)
+	}
+
+	for _, t := range []string{SetValue, SetString, SetFile} {
+		for _, v := range cli["--"+t].([]string) {
+			o, err := newValueOverride(t, v)
+			if err != nil {
+				return nil, err
+			}
+
+			c.ChartsConfigurationOptions.Values = append(c.ChartsConfigurationOptions.Values, o)
+		}
+	}
+
+	c.StatePath, _ = cli["--state"].(string)
+	c.PruneOutput, _ = cli["--prune-output"].(string)
+
+	if c.PruneOutput != "" && c.StatePath == "" {
+		return nil, errors.New("Invalid argument: --prune-output requires --state")
+	}
+
 	if cli["--partials-dir"] != nil {
 		c.PartialTemplatesPath, _ = cli["--partials-dir"].(string)
 	}
 
 	return c, nil
 }
+
+func newValueOverride(t, v string) (*ValueOverride, error) {
+	p := strings.SplitN(v, ".", 2)
+	if len(p) != 2 || p[0] == "" || strings.Contains(p[0], "=") {
+		return nil, fmt.Errorf("Invalid argument: --%s=%s, must be in the format CHART.KEY=VALUE", t, v)
+	}
+
+	o := &ValueOverride{Type: t, Chart: p[0], Values: p[1]}
+
+	if _, err := strvals.ParseString(o.Values); err != nil {
+		return nil, fmt.Errorf("Invalid argument: --%s=%s: %s", t, v, err)
+	}
+
+	return o, nil
+}
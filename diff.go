@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/blendle/kubecrt/chart"
+	"github.com/blendle/kubecrt/chartsconfig"
+	"github.com/blendle/kubecrt/config"
+	"github.com/blendle/kubecrt/manifest"
+	"github.com/blendle/kubecrt/schema"
+)
+
+// diff renders the old and new side, prints the differences between their
+// resources, and returns the exit status: 0 without differences, 1 with
+// differences, and 2 or higher on errors. Using "--live", the old side is a
+// snapshot of live objects, and the drift between it and the new side is
+// printed.
+func diff(opts *config.CLIOptions) int {
+	sides := []string{opts.DiffOld, opts.DiffNew}
+	configs := make([]*chartsconfig.ChartsConfiguration, len(sides))
+	resources := make([][]*manifest.Manifest, len(sides))
+
+	var offline, charts bool
+
+	for i, path := range sides {
+		ok, err := isManifests(path)
+		if err != nil {
+			return report(&chart.Error{Kind: chart.IOError, Err: err}, 2)
+		}
+
+		if ok {
+			if resources[i], err = manifest.Load(path); err != nil {
+				return report(&chart.Error{Kind: chart.IOError, Err: err}, 2)
+			}
+			continue
+		}
+
+		if opts.DiffLive && i == 0 {
+			err = errors.New("--live requires OLD to be a file or directory of live objects")
+			return report(&chart.Error{Kind: chart.ArgumentError, Err: err}, 2)
+		}
+
+		if configs[i], err = loadChartsConfiguration([]string{path}, opts); err != nil {
+			return report(err, 2)
+		}
+
+		// Live objects always have a namespace, so the rendered resources need
+		// one as well to be matched.
+		if opts.DiffLive && configs[i].EnforceNamespace == "" {
+			configs[i].EnforceNamespace = chartsconfig.EnforceNamespaceWarn
+		}
+
+		offline = offline || (configs[i].Offline != nil && *configs[i].Offline)
+		charts = true
+	}
+
+	if charts {
+		if err := initHelm(opts, offline); err != nil {
+			return report(err, 2)
+		}
+	}
+
+	for i, cc := range configs {
+		if cc == nil {
+			continue
+		}
+
+		var err error
+		lockPath := filepath.Join(filepath.Dir(sides[i]), config.LockfileName)
+
+		if resources[i], err = render(cc, opts, lockPath); err != nil {
+			return report(err, 2)
+		}
+	}
+
+	keys, err := mergeKeys(configs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: comparing lists by position: %s\n", err)
+	}
+
+	compare, summary := manifest.Diff, "%d added, %d removed, %d changed\n"
+	if opts.DiffLive {
+		compare, summary = manifest.DiffLive, "%d missing, %d orphaned, %d drifted\n"
+
+		if err := setNamespace(resources[1], opts.ChartsConfigurationOptions.Namespace); err != nil {
+			return report(err, 2)
+		}
+	}
+
+	diffs, err := compare(resources[0], resources[1], keys)
+	if err != nil {
+		return report(&chart.Error{Kind: chart.RenderError, Err: err}, 2)
+	}
+
+	count := map[string]int{}
+
+	for _, d := range diffs {
+		count[d.Type]++
+
+		fmt.Printf("%s %s\n", d.Type, d.Key)
+		for _, c := range d.Changes {
+			fmt.Printf("    %s\n", c)
+		}
+	}
+
+	if len(diffs) > 0 {
+		fmt.Println()
+	}
+
+	fmt.Printf(summary, count[manifest.Added], count[manifest.Removed], count[manifest.Changed])
+
+	if len(diffs) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// mergeKeys returns the merge keys of the Kubernetes version configured on the
+// new side, or the old side if the new side are manifests, or those of the
+// newest bundled version, if none is configured.
+func mergeKeys(configs []*chartsconfig.ChartsConfiguration) (manifest.MergeKeys, error) {
+	var kubeVersion string
+	for _, cc := range configs {
+		if cc != nil && cc.KubeVersion != "" {
+			kubeVersion = cc.KubeVersion
+		}
+	}
+
+	p, err := schema.NewPatcher(kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// isManifests returns whether path is a directory, or a file containing
+// Kubernetes resources, as opposed to a charts configuration file.
+func isManifests(path string) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	if fi.IsDir() {
+		return true, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	// Charts configuration files are templates, which are not necessarily
+	// valid YAML before they are rendered.
+	ms, err := manifest.Split("", path, string(b))
+	if err != nil {
+		return false, nil
+	}
+
+	for _, m := range ms {
+		if m.Head.Kind != "" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// setNamespace sets the namespace of the namespaced resources without one. An
+// error is returned if there are such resources, but no namespace is given, as
+// they can never be matched with live objects.
+func setNamespace(ms []*manifest.Manifest, namespace string) error {
+	clusterScoped, err := manifest.ClusterScopedKinds(ms)
+	if err != nil {
+		return &chart.Error{Kind: chart.RenderError, Err: err}
+	}
+
+	for _, m := range ms {
+		if m.Head.Kind == "" || m.Head.Metadata.Namespace != "" || clusterScoped[m.Head.Kind] {
+			continue
+		}
+
+		if namespace == "" {
+			err = fmt.Errorf("%s: %s %s has no namespace, please pass \"--namespace=my-namespace\"", m.Template, m.Head.Kind, m.Head.Metadata.Name)
+			return &chart.Error{Kind: chart.ArgumentError, Err: err}
+		}
+
+		if err = m.SetNamespace(namespace); err != nil {
+			return &chart.Error{Kind: chart.RenderError, Err: err}
+		}
+	}
+
+	return nil
+}
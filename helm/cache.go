@@ -0,0 +1,69 @@
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// CachedChart finds the highest version of a chart matching the SemVer
+// constraint, within the chart archives previously downloaded to dir.
+func CachedChart(dir, name, constraint string) (string, error) {
+	var c *semver.Constraints
+	var err error
+
+	if constraint != "" {
+		c, err = semver.NewConstraint(constraint)
+		if err != nil {
+			return "", fmt.Errorf("invalid chart version/constraint format: %s", err)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", notCachedError(name, constraint)
+	}
+
+	base := filepath.Base(name) + "-"
+	archives := map[*semver.Version]string{}
+	var versions []*semver.Version
+
+	for _, f := range files {
+		n := f.Name()
+		if f.IsDir() || !strings.HasPrefix(n, base) || !strings.HasSuffix(n, ".tgz") {
+			continue
+		}
+
+		v, err := semver.NewVersion(strings.TrimSuffix(strings.TrimPrefix(n, base), ".tgz"))
+		if err != nil {
+			continue
+		}
+
+		if c != nil && !c.Check(v) {
+			continue
+		}
+
+		archives[v] = filepath.Join(dir, n)
+		versions = append(versions, v)
+	}
+
+	if len(versions) == 0 {
+		return "", notCachedError(name, constraint)
+	}
+
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+
+	return archives[versions[0]], nil
+}
+
+func notCachedError(name, constraint string) error {
+	if constraint == "" {
+		constraint = "(any)"
+	}
+
+	return fmt.Errorf("chart %s version %s not cached, unable to download it in offline mode", name, constraint)
+}
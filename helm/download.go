@@ -0,0 +1,53 @@
+package helm
+
+import (
+	"os"
+	"sync"
+
+	"k8s.io/helm/pkg/downloader"
+	"k8s.io/helm/pkg/getter"
+	"k8s.io/helm/pkg/helm/helmpath"
+)
+
+// repoLock guards the repositories file and the cached repository indexes,
+// which are written when adding a repository, and read when resolving charts.
+var repoLock sync.RWMutex
+
+var downloads = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: map[string]*sync.Mutex{}}
+
+// DownloadChart downloads the given version of a chart to the dest directory,
+// and returns the path of the chart archive. Concurrent downloads of the same
+// chart version are serialised.
+func DownloadChart(home helmpath.Home, name, version, dest string) (string, error) {
+	repoLock.RLock()
+	defer repoLock.RUnlock()
+
+	l := downloadLock(name + "-" + version)
+	l.Lock()
+	defer l.Unlock()
+
+	dl := downloader.ChartDownloader{
+		HelmHome: home,
+		Out:      os.Stdout,
+		Getters:  getter.All(settings),
+	}
+
+	filename, _, err := dl.DownloadTo(name, version, dest)
+	return filename, err
+}
+
+func downloadLock(key string) *sync.Mutex {
+	downloads.Lock()
+	defer downloads.Unlock()
+
+	l, ok := downloads.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		downloads.locks[key] = l
+	}
+
+	return l
+}
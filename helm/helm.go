@@ -7,6 +7,10 @@ import (
 
 var settings environment.EnvSettings
 
+// Offline disables all network access. When enabled, only the repository
+// indexes and chart archives cached in the Helm home are used.
+var Offline bool
+
 func init() {
 	settings.Home = helmpath.Home(environment.DefaultHelmHome)
 }
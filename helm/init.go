@@ -15,7 +15,8 @@ const (
 	stableRepositoryURL = "https://charts.helm.sh/stable"
 )
 
-// Init makes sure the Helm home path exists and the required subfolders.
+// Init makes sure the Helm home path exists and the required subfolders. Unless
+// running in offline mode, the repository indexes are updated as well.
 func Init() error {
 	if err := ensureDirectories(settings.Home); err != nil {
 		return err
@@ -29,6 +30,10 @@ func Init() error {
 		return err
 	}
 
+	if Offline {
+		return nil
+	}
+
 	if err := ensureUpdatedRepos(settings.Home); err != nil {
 		return err
 	}
@@ -124,6 +129,10 @@ func initStableRepo(cacheFile string) (*repo.Entry, error) {
 		return nil, err
 	}
 
+	if Offline {
+		return &c, nil
+	}
+
 	// In this case, the cacheFile is always absolute. So passing empty string
 	// is safe.
 	if err := r.DownloadIndexFile(""); err != nil {
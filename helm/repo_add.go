@@ -2,13 +2,18 @@ package helm
 
 import (
 	"fmt"
+	"os"
 
 	"k8s.io/helm/pkg/getter"
 	"k8s.io/helm/pkg/repo"
 )
 
-// AddRepository adds a new repository to the Helm index.
+// AddRepository adds a new repository to the Helm index. In offline mode, the
+// repository index has to be cached already.
 func AddRepository(name, url string) error {
+	repoLock.Lock()
+	defer repoLock.Unlock()
+
 	home := settings.Home
 
 	f, err := repo.LoadRepositoriesFile(home.RepositoryFile())
@@ -26,6 +31,16 @@ func AddRepository(name, url string) error {
 		CAFile:   "",
 	}
 
+	if Offline {
+		if _, err := os.Stat(cif); err != nil {
+			return fmt.Errorf("index of repository %q (%s) not cached, unable to download it in offline mode", name, url)
+		}
+
+		f.Update(&c)
+
+		return f.WriteFile(home.RepositoryFile(), 0644)
+	}
+
 	r, err := repo.NewChartRepository(&c, getter.All(settings))
 	if err != nil {
 		return err
@@ -0,0 +1,47 @@
+package helm
+
+import (
+	"strings"
+
+	"k8s.io/helm/pkg/repo"
+)
+
+// RepositoryURL returns the URL of a repository in the Helm index, or an empty
+// string if the repository is unknown.
+func RepositoryURL(name string) string {
+	repoLock.RLock()
+	defer repoLock.RUnlock()
+
+	f, err := repo.LoadRepositoriesFile(settings.Home.RepositoryFile())
+	if err != nil {
+		return ""
+	}
+
+	for _, e := range f.Repositories {
+		if e.Name == name {
+			return e.URL
+		}
+	}
+
+	return ""
+}
+
+// RepositoryName returns the name of the repository in the Helm index with the
+// given URL, or an empty string if no such repository exists.
+func RepositoryName(url string) string {
+	repoLock.RLock()
+	defer repoLock.RUnlock()
+
+	f, err := repo.LoadRepositoriesFile(settings.Home.RepositoryFile())
+	if err != nil {
+		return ""
+	}
+
+	for _, e := range f.Repositories {
+		if strings.TrimSuffix(e.URL, "/") == strings.TrimSuffix(url, "/") {
+			return e.Name
+		}
+	}
+
+	return ""
+}
@@ -12,6 +12,9 @@ import (
 // GetAcceptableVersion accepts a SemVer constraint, and finds the best matching
 // chart version.
 func GetAcceptableVersion(name, constraint string) (string, error) {
+	repoLock.RLock()
+	defer repoLock.RUnlock()
+
 	index, err := buildIndex()
 	if err != nil {
 		return "", err
@@ -2,53 +2,143 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/blendle/kubecrt/chart"
 	"github.com/blendle/kubecrt/chartsconfig"
 	"github.com/blendle/kubecrt/config"
 	"github.com/blendle/kubecrt/helm"
+	"github.com/blendle/kubecrt/manifest"
+	"github.com/blendle/kubecrt/schema"
 	"github.com/ghodss/yaml"
 )
 
+// exitCodes are the exit statuses for each kind of error. Other errors exit
+// with status 1, or 2 when comparing renders, as status 1 means differences
+// were found.
+var exitCodes = map[chart.ErrorKind]int{
+	chart.ConfigError:     3,
+	chart.ResolutionError: 4,
+	chart.NetworkError:    5,
+	chart.RenderError:     6,
+	chart.ValidationError: 7,
+	chart.ArgumentError:   8,
+	chart.IOError:         9,
+}
+
 func main() {
 	cli := config.CLI()
 	opts, err := config.NewCLIOptions(cli)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "kubecrt arguments error: \n\n%s\n", err)
-		os.Exit(1)
+		os.Exit(report(&chart.Error{Kind: chart.ArgumentError, Err: err}, 1))
 	}
 
-	if err = helm.Init(); err != nil {
-		fmt.Fprintf(os.Stderr, "error initialising helm: \n\n%s\n", err)
-		os.Exit(1)
+	if opts.Diff {
+		os.Exit(diff(opts))
 	}
 
-	if cli["--repo"] != nil {
-		for _, r := range strings.Split(cli["--repo"].(string), ",") {
-			p := strings.SplitN(r, "=", 2)
-			repo := strings.TrimSpace(string(p[0]))
-			url := strings.TrimSpace(string(p[1]))
+	cc, err := loadChartsConfiguration(opts.ChartsConfigurationPaths, opts)
+	if err != nil {
+		os.Exit(report(err, 1))
+	}
 
-			if err = helm.AddRepository(repo, url); err != nil {
-				fmt.Fprintf(os.Stderr, "error adding repository: \n\n%s\n", err)
-				os.Exit(1)
+	if err = initHelm(opts, cc.Offline != nil && *cc.Offline); err != nil {
+		os.Exit(report(err, 1))
+	}
+
+	ms, err := render(cc, opts, opts.LockfilePath)
+	if err != nil {
+		os.Exit(report(err, 1))
+	}
+
+	if opts.Validate {
+		if err = validate(ms, cc.KubeVersion, opts.SchemaDir); err != nil {
+			os.Exit(report(err, 1))
+		}
+	}
+
+	var state *manifest.State
+	if opts.StatePath != "" {
+		if state, err = prune(ms, opts.StatePath, opts.PruneOutput); err != nil {
+			os.Exit(report(&chart.Error{Kind: chart.IOError, Err: fmt.Errorf("state: %s", err)}, 1))
+		}
+	}
+
+	if opts.OutputDir != "" {
+		if err = manifest.WriteDir(opts.OutputDir, opts.OutputLayout, ms); err != nil {
+			os.Exit(report(&chart.Error{Kind: chart.IOError, Err: fmt.Errorf("output: %s", err)}, 1))
+		}
+	} else {
+		out := manifest.Encode(ms)
+
+		if opts.OutputJSON {
+			out, err = toJSON(out)
+			if err != nil {
+				err = fmt.Errorf("unable to convert resources to JSON: %s", err)
+				os.Exit(report(&chart.Error{Kind: chart.RenderError, Err: err}, 1))
 			}
 		}
+
+		if cli["--output"] == nil {
+			fmt.Print(string(out))
+		} else if err = ioutil.WriteFile(cli["--output"].(string), out, 0644); err != nil {
+			os.Exit(report(&chart.Error{Kind: chart.IOError, Err: fmt.Errorf("output: %s", err)}, 1))
+		}
 	}
 
-	cfg, err := readInput(opts.ChartsConfigurationPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "charts config IO error: \n\n%s\n", err)
-		os.Exit(1)
+	// The state is only recorded once the resources are written, so that
+	// resources that failed to be written are reported again on the next run.
+	if state != nil {
+		if err = state.WriteFile(opts.StatePath); err != nil {
+			os.Exit(report(&chart.Error{Kind: chart.IOError, Err: fmt.Errorf("state: %s", err)}, 1))
+		}
 	}
 
-	cc, err := chartsconfig.NewChartsConfiguration(cfg, opts.PartialTemplatesPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "charts config parsing error: \n\n%s\n", err)
-		os.Exit(1)
+	// The lockfile is only updated once the resources are validated and
+	// written, so that a failed run leaves it untouched.
+	if err = writeLock(cc, opts.LockfilePath); err != nil {
+		os.Exit(report(&chart.Error{Kind: chart.IOError, Err: fmt.Errorf("charts lock: %s", err)}, 1))
+	}
+}
+
+// loadChartsConfiguration reads and merges the charts configuration files, and
+// applies the CLI options to the result.
+func loadChartsConfiguration(paths []string, opts *config.CLIOptions) (*chartsconfig.ChartsConfiguration, error) {
+	var cc *chartsconfig.ChartsConfiguration
+
+	for _, path := range paths {
+		cfg, err := readInput(path)
+		if err != nil {
+			return nil, &chart.Error{Kind: chart.IOError, Err: err}
+		}
+
+		c, err := chartsconfig.NewChartsConfiguration(cfg, opts.PartialTemplatesPath, filepath.Dir(path))
+		if err != nil {
+			return nil, &chart.Error{Kind: chart.ConfigError, Err: fmt.Errorf("%s: %s", path, err)}
+		}
+
+		if cc == nil {
+			cc = c
+			continue
+		}
+
+		if err = cc.Merge(c); err != nil {
+			return nil, &chart.Error{Kind: chart.ConfigError, Err: fmt.Errorf("%s: %s", path, err)}
+		}
+	}
+
+	env := opts.ChartsConfigurationOptions.Environment
+	if env != "" {
+		cc.Environment = env
+	}
+
+	if err := cc.ApplyEnvironment(); err != nil {
+		return nil, &chart.Error{Kind: chart.ConfigError, Err: err}
 	}
 
 	name := opts.ChartsConfigurationOptions.Name
@@ -61,34 +151,168 @@ func main() {
 		cc.Namespace = namespace
 	}
 
-	if err = cc.Validate(); err != nil {
-		fmt.Fprintf(os.Stderr, "charts validation error: \n\n%s\n", err)
-		os.Exit(1)
+	order := opts.ChartsConfigurationOptions.Order
+	if order != "" {
+		cc.Order = order
+	}
+
+	if opts.KubeVersion != "" {
+		cc.KubeVersion = opts.KubeVersion
+	}
+
+	cc.APIVersions = append(cc.APIVersions, opts.APIVersions...)
+
+	if err := cc.ApplyValueOverrides(opts.ChartsConfigurationOptions.Values); err != nil {
+		return nil, &chart.Error{Kind: chart.ArgumentError, Err: err}
+	}
+
+	if err := cc.Validate(); err != nil {
+		return nil, &chart.Error{Kind: chart.ConfigError, Err: err}
 	}
 
-	out, err := cc.ParseCharts()
+	return cc, nil
+}
+
+// initHelm initialises the Helm home directory, and adds the repositories set
+// through the CLI.
+func initHelm(opts *config.CLIOptions, offline bool) error {
+	helm.Offline = opts.Offline || offline
+
+	if err := helm.Init(); err != nil {
+		return &chart.Error{Kind: chart.IOError, Err: fmt.Errorf("unable to initialise helm: %s", err)}
+	}
+
+	for _, r := range opts.Repositories {
+		if err := helm.AddRepository(r.Name, r.URL); err != nil {
+			return &chart.Error{Kind: chart.NetworkError, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// render renders the charts, using the chart versions locked in the lockfile
+// at lockPath, unless the lock is being updated, or there is no lockfile. Any
+// warnings are printed to stderr.
+func render(cc *chartsconfig.ChartsConfiguration, opts *config.CLIOptions, lockPath string) ([]*manifest.Manifest, error) {
+	if !opts.UpdateLock && lockPath != "" {
+		lock, err := chartsconfig.LoadLockfile(lockPath)
+		if err != nil {
+			return nil, &chart.Error{Kind: chart.IOError, Err: fmt.Errorf("charts lock: %s", err)}
+		}
+
+		cc.ApplyLock(lock)
+	}
+
+	ms, err := cc.ParseCharts(opts.Jobs)
+
+	for _, c := range cc.ChartsList {
+		for _, w := range c.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s\n", c.Location, w)
+		}
+	}
+
+	return ms, err
+}
+
+// writeLock updates the lockfile at lockPath with the chart versions resolved
+// by render, keeping the entries of charts that were not rendered.
+func writeLock(cc *chartsconfig.ChartsConfiguration, lockPath string) error {
+	if lockPath == "" {
+		return nil
+	}
+
+	lock, err := chartsconfig.LoadLockfile(lockPath)
+	if err != nil {
+		return err
+	}
+
+	return cc.Lockfile(lock).WriteFile(lockPath)
+}
+
+// prune reports the resources recorded in the state file that are no longer
+// rendered, either on stderr, or as a manifest written to pruneOutput, and
+// returns the state of the rendered resources, to be recorded in the state
+// file.
+func prune(ms []*manifest.Manifest, statePath, pruneOutput string) (*manifest.State, error) {
+	previous, err := manifest.LoadState(statePath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "chart parsing error: %s\n", err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	if opts.OutputJSON {
-		out, err = toJSON(out)
+	state := manifest.NewState(ms)
+	removed := previous.Removed(state)
+
+	if pruneOutput != "" {
+		b, err := manifest.EncodeDelete(removed)
 		if err != nil {
-			fmt.Printf("error converting chart to JSON format: %s\n", err)
-			os.Exit(1)
+			return nil, err
+		}
+
+		if err = ioutil.WriteFile(pruneOutput, b, 0644); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, r := range removed {
+			fmt.Fprintf(os.Stderr, "no longer rendered: %s\n", r)
 		}
 	}
 
-	if cli["--output"] == nil {
-		fmt.Print(string(out))
-		return
+	return state, nil
+}
+
+// validate validates the resources against the schemas of the Kubernetes
+// version. Any violations are returned as a single validation error.
+func validate(ms []*manifest.Manifest, kubeVersion, schemaDir string) error {
+	v, err := schema.NewValidator(kubeVersion, schemaDir)
+	if err != nil {
+		return &chart.Error{Kind: chart.ConfigError, Err: err}
+	}
+
+	violations, err := v.Validate(ms)
+	if err != nil {
+		return &chart.Error{Kind: chart.ValidationError, Err: err}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, len(violations))
+	for i := range violations {
+		msgs[i] = violations[i].Error()
+	}
+
+	return &chart.Error{Kind: chart.ValidationError, Err: errors.New(strings.Join(msgs, "\n"))}
+}
+
+// report prints the error to stderr, and returns the exit status for it. Errors
+// of a known kind are printed with a heading describing their kind, and have
+// the exit status of that kind. All other errors are printed as is, and have
+// the fallback exit status.
+func report(err error, fallback int) int {
+	var kind chart.ErrorKind
+
+	var errs chartsconfig.Errors
+	var e *chart.Error
+
+	switch {
+	case errors.As(err, &errs):
+		kind = errs.Kind()
+	case errors.As(err, &e):
+		kind = e.Kind
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		return fallback
 	}
 
-	if err = ioutil.WriteFile(cli["--output"].(string), out, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "output IO error: %s\n", err)
-		os.Exit(1)
+	fmt.Fprintf(os.Stderr, "%s error: \n\n%s\n", kind, err)
+
+	if code, ok := exitCodes[kind]; ok {
+		return code
 	}
+
+	return fallback
 }
 
 func readInput(input string) ([]byte, error) {
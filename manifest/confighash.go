@@ -0,0 +1,199 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigHashAnnotation is the pod template annotation containing the hash of
+// the ConfigMaps and Secrets a workload references.
+const ConfigHashAnnotation = "kubecrt/config-hash"
+
+// configHashKinds are the kinds of workloads that get a ConfigHashAnnotation.
+var configHashKinds = map[string]bool{
+	"DaemonSet":   true,
+	"Deployment":  true,
+	"StatefulSet": true,
+}
+
+type reference struct {
+	Name string `yaml:"name"`
+}
+
+type container struct {
+	EnvFrom []struct {
+		ConfigMapRef *reference `yaml:"configMapRef"`
+		SecretRef    *reference `yaml:"secretRef"`
+	} `yaml:"envFrom"`
+	Env []struct {
+		ValueFrom *struct {
+			ConfigMapKeyRef *reference `yaml:"configMapKeyRef"`
+			SecretKeyRef    *reference `yaml:"secretKeyRef"`
+		} `yaml:"valueFrom"`
+	} `yaml:"env"`
+}
+
+type workload struct {
+	Spec struct {
+		Template struct {
+			Spec struct {
+				Volumes []struct {
+					ConfigMap *reference `yaml:"configMap"`
+					Secret    *struct {
+						SecretName string `yaml:"secretName"`
+					} `yaml:"secret"`
+					Projected *struct {
+						Sources []struct {
+							ConfigMap *reference `yaml:"configMap"`
+							Secret    *reference `yaml:"secret"`
+						} `yaml:"sources"`
+					} `yaml:"projected"`
+				} `yaml:"volumes"`
+				Containers     []container `yaml:"containers"`
+				InitContainers []container `yaml:"initContainers"`
+			} `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+type configData struct {
+	Data       map[string]interface{} `yaml:"data" json:"data,omitempty"`
+	BinaryData map[string]interface{} `yaml:"binaryData" json:"binaryData,omitempty"`
+	StringData map[string]interface{} `yaml:"stringData" json:"stringData,omitempty"`
+}
+
+// SetConfigHashes adds a ConfigHashAnnotation to the pod templates of the
+// Deployments, StatefulSets and DaemonSets in ms, containing a hash of the
+// data of the ConfigMaps and Secrets in ms they reference through volumes,
+// envFrom or env. Changing the data of any of those thereby rolls out the
+// workload. References to ConfigMaps and Secrets not in ms are ignored.
+func SetConfigHashes(ms []*Manifest) error {
+	hashes := map[string][]byte{}
+
+	for _, m := range ms {
+		if !isConfig(m) {
+			continue
+		}
+
+		h, err := m.dataHash()
+		if err != nil {
+			return err
+		}
+
+		hashes[m.Head.Kind+"/"+m.Head.Metadata.Name] = h
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	for _, m := range ms {
+		if !configHashKinds[m.Head.Kind] {
+			continue
+		}
+
+		var w workload
+		if err := yaml.Unmarshal([]byte(m.Content), &w); err != nil {
+			return fmt.Errorf("%s: unable to parse resource: %s", m.Template, err)
+		}
+
+		h := sha256.New()
+		var found bool
+
+		for _, ref := range w.references() {
+			if b, ok := hashes[ref]; ok {
+				fmt.Fprintf(h, "%s=%x\n", ref, b)
+				found = true
+			}
+		}
+
+		if !found {
+			continue
+		}
+
+		annotations := map[string]string{ConfigHashAnnotation: fmt.Sprintf("%x", h.Sum(nil))}
+
+		err := m.edit(func(doc yaml.MapSlice) yaml.MapSlice {
+			return setPath(doc, []string{"spec", "template", "metadata", "annotations"}, annotations)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isConfig(m *Manifest) bool {
+	return m.Head.Kind == "ConfigMap" || m.Head.Kind == "Secret"
+}
+
+// dataHash returns the hash of the data of a ConfigMap or Secret.
+func (m *Manifest) dataHash() ([]byte, error) {
+	var d configData
+	if err := yaml.Unmarshal([]byte(m.Content), &d); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse resource: %s", m.Template, err)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s %s: %s", m.Template, m.Head.Kind, m.Head.Metadata.Name, err)
+	}
+
+	h := sha256.Sum256(b)
+	return h[:], nil
+}
+
+// references returns the ConfigMaps and Secrets referenced by the pod template
+// of the workload, as "Kind/name", in order.
+func (w *workload) references() []string {
+	refs := map[string]bool{}
+	spec := w.Spec.Template.Spec
+
+	add := func(kind string, r *reference) {
+		if r != nil && r.Name != "" {
+			refs[kind+"/"+r.Name] = true
+		}
+	}
+
+	for _, v := range spec.Volumes {
+		add("ConfigMap", v.ConfigMap)
+
+		if v.Secret != nil {
+			add("Secret", &reference{Name: v.Secret.SecretName})
+		}
+
+		if v.Projected != nil {
+			for _, s := range v.Projected.Sources {
+				add("ConfigMap", s.ConfigMap)
+				add("Secret", s.Secret)
+			}
+		}
+	}
+
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		for _, e := range c.EnvFrom {
+			add("ConfigMap", e.ConfigMapRef)
+			add("Secret", e.SecretRef)
+		}
+
+		for _, e := range c.Env {
+			if e.ValueFrom != nil {
+				add("ConfigMap", e.ValueFrom.ConfigMapKeyRef)
+				add("Secret", e.ValueFrom.SecretKeyRef)
+			}
+		}
+	}
+
+	out := make([]string, 0, len(refs))
+	for r := range refs {
+		out = append(out, r)
+	}
+	sort.Strings(out)
+
+	return out
+}
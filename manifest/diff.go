@@ -0,0 +1,344 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// Added marks a resource or field that only exists in the new manifests.
+	Added = "+"
+
+	// Removed marks a resource or field that only exists in the old manifests.
+	Removed = "-"
+
+	// Changed marks a resource or field that exists in both the old and new
+	// manifests, but differs.
+	Changed = "~"
+)
+
+// Change is a difference in a single resource, or in a single field of a
+// resource.
+type Change struct {
+	// Type is the type of change, one of Added, Removed or Changed.
+	Type string
+
+	// Path is the path of the field that changed, empty for the resource
+	// itself.
+	Path string
+
+	// Old and New are the old and new values, nil if the resource or field
+	// did not exist.
+	Old, New interface{}
+}
+
+// ResourceDiff contains the changes of a single resource.
+type ResourceDiff struct {
+	// Key identifies the resource, by its apiVersion, kind, namespace and name.
+	Key string
+
+	// Type is the type of change of the resource, one of Added, Removed or
+	// Changed.
+	Type string
+
+	// Changes are the changed fields of a changed resource, ordered by path.
+	Changes []*Change
+}
+
+// MergeKeys looks up the merge keys of list fields, which identify the
+// elements of a list, such as "name" for the containers of a pod. It is
+// implemented by schema.Patcher.
+type MergeKeys interface {
+	// MergeKey returns the merge key of the elements of the list field of a
+	// resource, given by the map keys leading up to it, or an empty string if
+	// its elements have no merge key.
+	MergeKey(apiVersion, kind string, fields []string) string
+}
+
+// Key returns the identity of the resource, consisting of its apiVersion,
+// kind, namespace and name.
+func (m *Manifest) Key() string {
+	name := m.Head.Metadata.Name
+	if m.Head.Metadata.Namespace != "" {
+		name = m.Head.Metadata.Namespace + "/" + name
+	}
+
+	return fmt.Sprintf("%s %s %s", m.Head.APIVersion, m.Head.Kind, name)
+}
+
+// Diff compares two sets of manifests, matching resources by their Key, and
+// returns the differences ordered by key. Resources that are equal are left
+// out. Documents without a kind are ignored.
+//
+// The elements of lists with a merge key are matched by that key, so that
+// reordering them is not a change. Other lists, or all lists if keys is nil,
+// are compared by position.
+func Diff(old, new []*Manifest, keys MergeKeys) ([]*ResourceDiff, error) {
+	o, err := index(old)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := index(new)
+	if err != nil {
+		return nil, err
+	}
+
+	return diff(o, n, keys), nil
+}
+
+// diff compares two sets of resources, indexed by their key.
+func diff(o, n map[string]interface{}, mergeKeys MergeKeys) []*ResourceDiff {
+	keys := map[string]bool{}
+	for k := range o {
+		keys[k] = true
+	}
+	for k := range n {
+		keys[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var diffs []*ResourceDiff
+
+	for _, k := range sorted {
+		ov, inOld := o[k]
+		nv, inNew := n[k]
+
+		switch {
+		case !inOld:
+			diffs = append(diffs, &ResourceDiff{Key: k, Type: Added})
+		case !inNew:
+			diffs = append(diffs, &ResourceDiff{Key: k, Type: Removed})
+		default:
+			var changes []*Change
+			comparerFor(nv, mergeKeys).compare("", nil, ov, nv, &changes)
+
+			if len(changes) > 0 {
+				diffs = append(diffs, &ResourceDiff{Key: k, Type: Changed, Changes: changes})
+			}
+		}
+	}
+
+	return diffs
+}
+
+// String returns a human readable representation of the change.
+func (c *Change) String() string {
+	switch c.Type {
+	case Added:
+		return fmt.Sprintf("%s %s: %s", c.Type, c.Path, encodeValue(c.New))
+	case Removed:
+		return fmt.Sprintf("%s %s: %s", c.Type, c.Path, encodeValue(c.Old))
+	default:
+		return fmt.Sprintf("%s %s: %s -> %s", c.Type, c.Path, encodeValue(c.Old), encodeValue(c.New))
+	}
+}
+
+func index(ms []*Manifest) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(ms))
+
+	for _, m := range ms {
+		if m.Head.Kind == "" {
+			continue
+		}
+
+		b, err := yaml.YAMLToJSON([]byte(m.Content))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", m.Template, err)
+		}
+
+		var obj interface{}
+		if err = json.Unmarshal(b, &obj); err != nil {
+			return nil, fmt.Errorf("%s: %s", m.Template, err)
+		}
+
+		k := m.Key()
+		if _, ok := out[k]; ok {
+			return nil, fmt.Errorf("%s: resource %s is defined multiple times", m.Template, k)
+		}
+
+		out[k] = obj
+	}
+
+	return out, nil
+}
+
+// comparer compares the fields of a single resource.
+type comparer struct {
+	keys       MergeKeys
+	apiVersion string
+	kind       string
+}
+
+func comparerFor(obj interface{}, keys MergeKeys) *comparer {
+	m, _ := obj.(map[string]interface{})
+	apiVersion, _ := m["apiVersion"].(string)
+	kind, _ := m["kind"].(string)
+
+	return &comparer{keys: keys, apiVersion: apiVersion, kind: kind}
+}
+
+// mergeKey returns the merge key of the elements of the list at fields, if
+// all elements of the given lists are maps with a unique value for that key.
+func (c *comparer) mergeKey(fields []string, lists ...[]interface{}) string {
+	if c.keys == nil {
+		return ""
+	}
+
+	key := c.keys.MergeKey(c.apiVersion, c.kind, fields)
+	if key == "" {
+		return ""
+	}
+
+	for _, l := range lists {
+		for i, e := range l {
+			m, ok := e.(map[string]interface{})
+			if !ok || m[key] == nil || indexOf(l[:i], key, m[key]) >= 0 {
+				return ""
+			}
+		}
+	}
+
+	return key
+}
+
+func (c *comparer) compare(path string, fields []string, old, new interface{}, changes *[]*Change) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := map[string]bool{}
+		for k := range o {
+			keys[k] = true
+		}
+		for k := range n {
+			keys[k] = true
+		}
+
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		for _, k := range sorted {
+			p := joinPath(path, k)
+			ov, inOld := o[k]
+			nv, inNew := n[k]
+
+			switch {
+			case !inOld:
+				*changes = append(*changes, &Change{Type: Added, Path: p, New: nv})
+			case !inNew:
+				*changes = append(*changes, &Change{Type: Removed, Path: p, Old: ov})
+			default:
+				c.compare(p, append(fields[:len(fields):len(fields)], k), ov, nv, changes)
+			}
+		}
+
+		return
+
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+
+		if key := c.mergeKey(fields, o, n); key != "" {
+			c.compareByKey(path, fields, key, o, n, changes)
+			return
+		}
+
+		for i := 0; i < len(o) || i < len(n); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+
+			switch {
+			case i >= len(o):
+				*changes = append(*changes, &Change{Type: Added, Path: p, New: n[i]})
+			case i >= len(n):
+				*changes = append(*changes, &Change{Type: Removed, Path: p, Old: o[i]})
+			default:
+				c.compare(p, fields, o[i], n[i], changes)
+			}
+		}
+
+		return
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, &Change{Type: Changed, Path: path, Old: old, New: new})
+	}
+}
+
+// compareByKey compares the elements of two lists, matched by their merge key.
+// Elements that only moved within the list are not a change.
+func (c *comparer) compareByKey(path string, fields []string, key string, old, new []interface{}, changes *[]*Change) {
+	for _, e := range old {
+		kv := e.(map[string]interface{})[key]
+		p := fmt.Sprintf("%s[%s=%v]", path, key, kv)
+
+		if j := indexOf(new, key, kv); j >= 0 {
+			c.compare(p, fields, e, new[j], changes)
+			continue
+		}
+
+		*changes = append(*changes, &Change{Type: Removed, Path: p, Old: e})
+	}
+
+	for _, e := range new {
+		kv := e.(map[string]interface{})[key]
+		if indexOf(old, key, kv) < 0 {
+			p := fmt.Sprintf("%s[%s=%v]", path, key, kv)
+			*changes = append(*changes, &Change{Type: Added, Path: p, New: e})
+		}
+	}
+}
+
+// indexOf returns the index of the map element in l with the given value for
+// key, or -1 if there is none.
+func indexOf(l []interface{}, key string, value interface{}) int {
+	for i, e := range l {
+		if m, ok := e.(map[string]interface{}); ok && reflect.DeepEqual(m[key], value) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// joinPath appends a key to a path. Keys containing dots or brackets, such as
+// most annotations, are quoted.
+func joinPath(path, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func encodeValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(b)
+}
@@ -0,0 +1,225 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultLayout is the default layout of the files written by WriteDir, with
+// one file per resource, grouped by release and chart.
+const DefaultLayout = "{{ .Release }}/{{ .Chart }}/{{ lower .Kind }}-{{ .Name }}.yaml"
+
+// IndexFile is the name of the file in which WriteDir records the files it
+// wrote, so that files no longer written to are removed on the next run.
+const IndexFile = ".kubecrt-files"
+
+// outputExtensions are the file extensions of the files containing resources,
+// as read by Load.
+var outputExtensions = []string{".yaml", ".yml", ".json"}
+
+// layoutData is the data available in the layout template.
+type layoutData struct {
+	Chart      string
+	Release    string
+	Template   string
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+}
+
+// WriteDir writes the manifests to files in dir. The path of each file is
+// determined by rendering the layout template for each manifest. Manifests
+// resolving to the same path are written to the same file, in order.
+//
+// The written files are recorded in the IndexFile in dir. Files recorded in a
+// previous run that are not written to are removed, as are any directories
+// left empty, so that dir only contains the current resources. Other files in
+// dir are never touched.
+func WriteDir(dir, layout string, ms []*Manifest) error {
+	tpl, err := template.New("layout").Funcs(sprig.TxtFuncMap()).Parse(layout)
+	if err != nil {
+		return fmt.Errorf("invalid output layout: %s", err)
+	}
+
+	var paths []string
+	files := map[string][]*Manifest{}
+
+	for _, m := range ms {
+		if m.Head.Kind == "" {
+			if isEmpty(m) {
+				continue
+			}
+
+			return fmt.Errorf("%s: resource without kind cannot be written to the output directory", m.Template)
+		}
+
+		p, err := layoutPath(tpl, m)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := files[p]; !ok {
+			paths = append(paths, p)
+		}
+		files[p] = append(files[p], m)
+	}
+
+	previous, err := readIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		path := filepath.Join(dir, p)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(path, Encode(files[p]), 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := removeStale(dir, previous, files); err != nil {
+		return err
+	}
+
+	return writeIndex(dir, paths)
+}
+
+func layoutPath(tpl *template.Template, m *Manifest) (string, error) {
+	var b bytes.Buffer
+
+	data := layoutData{
+		Chart:      strings.SplitN(m.Template, "/", 2)[0],
+		Release:    m.Release,
+		Template:   m.Template,
+		APIVersion: m.Head.APIVersion,
+		Kind:       m.Head.Kind,
+		Name:       m.Head.Metadata.Name,
+		Namespace:  m.Head.Metadata.Namespace,
+	}
+
+	if err := tpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("invalid output layout: %s", err)
+	}
+
+	p := filepath.Clean(strings.TrimSpace(b.String()))
+	if p == "." || filepath.IsAbs(p) || strings.HasPrefix(p, "..") {
+		return "", fmt.Errorf("%s: output path %q is outside of the output directory", m.Template, p)
+	}
+
+	return p, nil
+}
+
+// removeStale removes the files in dir listed in the previous index that are
+// no longer written to, and any directories left empty by their removal.
+func removeStale(dir string, previous []string, files map[string][]*Manifest) error {
+	var dirs []string
+
+	for _, p := range previous {
+		if _, ok := files[p]; ok {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, p)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		for d := filepath.Dir(p); d != "."; d = filepath.Dir(d) {
+			dirs = append(dirs, filepath.Join(dir, d))
+		}
+	}
+
+	// Remove the deepest directories first, so that parent directories only
+	// containing empty directories are removed as well.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, d := range dirs {
+		if fs, err := ioutil.ReadDir(d); err == nil && len(fs) == 0 {
+			if err := os.Remove(d); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readIndex returns the paths recorded in the IndexFile in dir, relative to
+// dir. No paths are returned if dir has no IndexFile.
+func readIndex(dir string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, IndexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		p := filepath.Clean(filepath.FromSlash(l))
+		if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s: path %q is outside of the output directory", IndexFile, l)
+		}
+
+		paths = append(paths, p)
+	}
+
+	return paths, nil
+}
+
+// writeIndex records the given paths in the IndexFile in dir.
+func writeIndex(dir string, paths []string) error {
+	var b bytes.Buffer
+
+	lines := make([]string, len(paths))
+	for i := range paths {
+		lines[i] = filepath.ToSlash(paths[i])
+	}
+	sort.Strings(lines)
+
+	for _, l := range lines {
+		b.WriteString(l + "\n")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, IndexFile), b.Bytes(), 0644)
+}
+
+// isEmpty returns true if the manifest contains no data, for example because
+// its template only rendered comments.
+func isEmpty(m *Manifest) bool {
+	var v interface{}
+	return yaml.Unmarshal([]byte(m.Content), &v) == nil && v == nil
+}
+
+func isOutputFile(path string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range outputExtensions {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/helm/pkg/hooks"
+)
+
+const (
+	// HooksInclude includes hooks in the output, along with all other
+	// resources.
+	HooksInclude = "include"
+
+	// HooksExclude leaves out all hooks.
+	HooksExclude = "exclude"
+
+	// HooksOnly leaves out all resources that are not hooks.
+	HooksOnly = "only"
+)
+
+// HookTypes are the hook types supported by Helm.
+var HookTypes = []string{
+	hooks.PreInstall,
+	hooks.PostInstall,
+	hooks.PreDelete,
+	hooks.PostDelete,
+	hooks.PreUpgrade,
+	hooks.PostUpgrade,
+	hooks.PreRollback,
+	hooks.PostRollback,
+	hooks.ReleaseTestSuccess,
+	hooks.ReleaseTestFailure,
+	hooks.CRDInstall,
+}
+
+// Hooks returns the hook types of the manifest, as defined by its
+// "helm.sh/hook" annotation. Manifests that are not hooks return nil.
+func (m *Manifest) Hooks() []string {
+	a, ok := m.Head.Metadata.Annotations[hooks.HookAnno]
+	if !ok {
+		return nil
+	}
+
+	var types []string
+	for _, t := range strings.Split(a, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	return types
+}
+
+// HookWeight returns the weight of the hook, as defined by its
+// "helm.sh/hook-weight" annotation. Invalid or missing weights are 0.
+func (m *Manifest) HookWeight() int {
+	w, _ := strconv.Atoi(strings.TrimSpace(m.Head.Metadata.Annotations[hooks.HookWeightAnno]))
+	return w
+}
+
+// ValidateHooks checks the hook policy and hook types.
+func ValidateHooks(policy string, types []string) error {
+	switch policy {
+	case "", HooksInclude, HooksExclude, HooksOnly:
+	default:
+		return fmt.Errorf("Unknown hooks policy %q, please use %q, %q or %q", policy, HooksInclude, HooksExclude, HooksOnly)
+	}
+
+	for _, t := range types {
+		if !isHookType(t) {
+			return fmt.Errorf("Unknown hook type %q, please use one of %s", t, strings.Join(HookTypes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// FilterHooks applies the hook policy to the manifests. If types is not
+// empty, only the hooks of those types are kept.
+func FilterHooks(ms []*Manifest, policy string, types []string) []*Manifest {
+	var out []*Manifest
+
+	for _, m := range ms {
+		h := m.Hooks()
+
+		switch {
+		case h == nil && policy != HooksOnly:
+		case h != nil && policy != HooksExclude && hasHookType(h, types):
+		default:
+			continue
+		}
+
+		out = append(out, m)
+	}
+
+	return out
+}
+
+// SortHooks moves hooks that run before the release is installed or upgraded
+// (pre-* and crd-install hooks) in front of all other resources, and all other
+// hooks after them. Hooks are ordered by their weight, then by their name. All
+// other resources keep their relative order.
+func SortHooks(ms []*Manifest) {
+	sort.SliceStable(ms, func(i, j int) bool {
+		pi, pj := hookPhase(ms[i]), hookPhase(ms[j])
+		if pi != pj || pi == 0 {
+			return pi < pj
+		}
+
+		wi, wj := ms[i].HookWeight(), ms[j].HookWeight()
+		if wi != wj {
+			return wi < wj
+		}
+
+		return ms[i].Head.Metadata.Name < ms[j].Head.Metadata.Name
+	})
+}
+
+// hookPhase returns -1 for hooks that run before the release is installed or
+// upgraded, 0 for regular resources, and 1 for all other hooks.
+func hookPhase(m *Manifest) int {
+	h := m.Hooks()
+	if h == nil {
+		return 0
+	}
+
+	for _, t := range h {
+		switch t {
+		case hooks.PreInstall, hooks.PreUpgrade, hooks.CRDInstall:
+			return -1
+		}
+	}
+
+	return 1
+}
+
+func hasHookType(h, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+
+	for _, t := range h {
+		for _, tt := range types {
+			if t == tt {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isHookType(t string) bool {
+	for _, ht := range HookTypes {
+		if t == ht {
+			return true
+		}
+	}
+
+	return false
+}
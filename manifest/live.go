@@ -0,0 +1,232 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// serverFields are the metadata fields populated by the API server, which are
+// never part of the desired state of a resource.
+var serverFields = []string{
+	"creationTimestamp",
+	"deletionGracePeriodSeconds",
+	"deletionTimestamp",
+	"generation",
+	"managedFields",
+	"resourceVersion",
+	"selfLink",
+	"uid",
+}
+
+// serverAnnotations are the annotations set by kubectl and the built-in
+// controllers.
+var serverAnnotations = []string{
+	"deployment.kubernetes.io/revision",
+	"deprecated.daemonset.template.generation",
+	"kubectl.kubernetes.io/last-applied-configuration",
+}
+
+// systemObjects are the resources Kubernetes creates in every namespace, which
+// are never reported as orphaned.
+var systemObjects = map[string]bool{
+	"ConfigMap kube-root-ca.crt": true,
+	"ServiceAccount default":     true,
+}
+
+// ExpandLists replaces the list documents in ms, such as the output of
+// "kubectl get -o yaml", by the resources they contain.
+func ExpandLists(ms []*Manifest) ([]*Manifest, error) {
+	var out []*Manifest
+
+	for _, m := range ms {
+		if !strings.HasSuffix(m.Head.Kind, "List") {
+			out = append(out, m)
+			continue
+		}
+
+		var list struct {
+			Items []yaml.MapSlice `yaml:"items"`
+		}
+
+		if err := yaml.Unmarshal([]byte(m.Content), &list); err != nil {
+			return nil, fmt.Errorf("%s: unable to parse %s: %s", m.Template, m.Head.Kind, err)
+		}
+
+		// Custom resources can have a kind ending in "List" as well.
+		if list.Items == nil {
+			out = append(out, m)
+			continue
+		}
+
+		for _, item := range list.Items {
+			b, err := yaml.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+
+			i := &Manifest{Chart: m.Chart, Release: m.Release, Template: m.Template}
+			if err = i.SetContent(string(b)); err != nil {
+				return nil, err
+			}
+
+			out = append(out, i)
+		}
+	}
+
+	return out, nil
+}
+
+// DiffLive compares rendered manifests against a snapshot of the live objects
+// in a cluster, and returns the differences ordered by key. Lists in the
+// snapshot are expanded, and the fields populated by the API server, such as
+// the status, uid and resourceVersion, are ignored, as are the fields only
+// set on live objects, such as defaults.
+//
+// Rendered resources missing from the cluster are reported as Added, and live
+// resources that are no longer rendered (orphaned) as Removed. Only live
+// resources of the kinds and in the namespaces that are rendered, and that are
+// not owned by another resource, can be orphaned. List elements are matched
+// the same way as by Diff.
+func DiffLive(live, rendered []*Manifest, keys MergeKeys) ([]*ResourceDiff, error) {
+	live, err := ExpandLists(live)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := index(live)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := index(rendered)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds, namespaces := map[string]bool{}, map[string]bool{}
+	for _, m := range rendered {
+		kinds[m.Head.Kind] = true
+		if m.Head.Metadata.Namespace != "" {
+			namespaces[m.Head.Metadata.Namespace] = true
+		}
+	}
+
+	for k, obj := range o {
+		if _, ok := n[k]; !ok && !orphaned(obj, kinds, namespaces) {
+			delete(o, k)
+		}
+	}
+
+	for _, obj := range o {
+		stripServerFields(obj)
+	}
+
+	for k, obj := range n {
+		stripServerFields(obj)
+
+		if lv, ok := o[k]; ok {
+			o[k] = comparerFor(obj, keys).prune(nil, lv, obj)
+		}
+	}
+
+	return diff(o, n, keys), nil
+}
+
+// orphaned returns whether a live object, that is not rendered, is to be
+// reported as orphaned. Only objects of a rendered kind, in a namespace that
+// resources are rendered in, can be orphaned, so that the objects of other
+// applications in the same snapshot are left out.
+func orphaned(obj interface{}, kinds, namespaces map[string]bool) bool {
+	m, _ := obj.(map[string]interface{})
+	meta, _ := m["metadata"].(map[string]interface{})
+	kind, _ := m["kind"].(string)
+	name, _ := meta["name"].(string)
+	namespace, _ := meta["namespace"].(string)
+
+	if !kinds[kind] || !namespaces[namespace] || systemObjects[kind+" "+name] {
+		return false
+	}
+
+	owners, _ := meta["ownerReferences"].([]interface{})
+	return len(owners) == 0
+}
+
+func stripServerFields(obj interface{}) {
+	m, _ := obj.(map[string]interface{})
+	delete(m, "status")
+
+	meta, ok := m["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for _, f := range serverFields {
+		delete(meta, f)
+	}
+
+	annotations, ok := meta["annotations"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for _, a := range serverAnnotations {
+		delete(annotations, a)
+	}
+
+	if len(annotations) == 0 {
+		delete(meta, "annotations")
+	}
+}
+
+// prune removes the fields from a live value that are not set in the rendered
+// value. List elements are pruned by the rendered element with the same merge
+// key, or by their position if the list has no merge key. Any additional live
+// elements are kept.
+func (c *comparer) prune(fields []string, live, rendered interface{}) interface{} {
+	switch r := rendered.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+
+		out := make(map[string]interface{}, len(r))
+		for k, v := range l {
+			if rv, ok := r[k]; ok {
+				out[k] = c.prune(append(fields[:len(fields):len(fields)], k), v, rv)
+			}
+		}
+
+		return out
+
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return live
+		}
+
+		key := c.mergeKey(fields, l, r)
+
+		out := make([]interface{}, len(l))
+		for i := range l {
+			if key != "" {
+				j := indexOf(r, key, l[i].(map[string]interface{})[key])
+				if j >= 0 {
+					out[i] = c.prune(fields, l[i], r[j])
+					continue
+				}
+			} else if i < len(r) {
+				out[i] = c.prune(fields, l[i], r[i])
+				continue
+			}
+
+			out[i] = l[i]
+		}
+
+		return out
+	}
+
+	return live
+}
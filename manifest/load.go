@@ -0,0 +1,40 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Load reads the manifests in a YAML or JSON file, or in all YAML and JSON
+// files in a directory and its subdirectories, in lexical order. The Template
+// of each manifest is set to the path of the file it was read from.
+func Load(path string) ([]*Manifest, error) {
+	var ms []*Manifest
+
+	err := filepath.Walk(path, func(p string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if f.IsDir() || (p != path && !isOutputFile(p)) {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		m, err := Split("", p, string(b))
+		if err != nil {
+			return err
+		}
+
+		ms = append(ms, m...)
+
+		return nil
+	})
+
+	return ms, err
+}
@@ -0,0 +1,91 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Manifest is a single Kubernetes resource document, rendered from a chart
+// template.
+type Manifest struct {
+	// Chart is the location of the chart that rendered the manifest.
+	Chart string
+
+	// Release is the release name the chart was rendered with.
+	Release string
+
+	// Template is the path of the template within the chart, e.g.
+	// "redis/templates/service.yaml".
+	Template string
+
+	// Content is the YAML document, without any leading document separator.
+	Content string
+
+	// Head contains the identifying fields of the resource.
+	Head *Head
+}
+
+// Head contains the fields of a resource used to identify and order it.
+type Head struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace"`
+		Labels      map[string]string `yaml:"labels"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+var sep = regexp.MustCompile("(?m)^---\\s*$")
+
+// Split takes the rendered output of a single template, and returns the
+// manifests it contains, in the order they are defined.
+func Split(chart, template, data string) ([]*Manifest, error) {
+	var ms []*Manifest
+
+	for _, d := range sep.Split(strings.TrimSpace(data), -1) {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+
+		m := &Manifest{Chart: chart, Template: template, Content: d}
+		if err := m.parseHead(); err != nil {
+			return nil, err
+		}
+
+		ms = append(ms, m)
+	}
+
+	return ms, nil
+}
+
+// Encode returns the manifests as a single YAML stream.
+func Encode(ms []*Manifest) []byte {
+	docs := make([]string, len(ms))
+	for i := range ms {
+		docs[i] = "---\n" + ms[i].Content
+	}
+
+	return []byte(strings.Join(docs, "\n\n") + "\n")
+}
+
+// SetContent replaces the YAML document of the manifest.
+func (m *Manifest) SetContent(content string) error {
+	m.Content = strings.TrimSpace(content)
+	return m.parseHead()
+}
+
+func (m *Manifest) parseHead() error {
+	m.Head = &Head{}
+
+	if err := yaml.Unmarshal([]byte(m.Content), m.Head); err != nil {
+		return fmt.Errorf("%s: unable to parse resource: %s", m.Template, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// podTemplates are the paths of the pod template of workload resources, by
+// kind.
+var podTemplates = map[string][][]string{
+	"Deployment":            {{"spec", "template"}},
+	"StatefulSet":           {{"spec", "template"}},
+	"DaemonSet":             {{"spec", "template"}},
+	"ReplicaSet":            {{"spec", "template"}},
+	"ReplicationController": {{"spec", "template"}},
+	"Job":                   {{"spec", "template"}},
+	"CronJob":               {{"spec", "jobTemplate"}, {"spec", "jobTemplate", "spec", "template"}},
+}
+
+// SetMetadata adds the labels and annotations to the metadata of the
+// resource, and to the pod template metadata of workload resources. Existing
+// labels and annotations with the same keys are replaced. Selectors are left
+// untouched.
+func (m *Manifest) SetMetadata(labels, annotations map[string]string) error {
+	if m.Head.Kind == "" || (len(labels) == 0 && len(annotations) == 0) {
+		return nil
+	}
+
+	return m.edit(func(doc yaml.MapSlice) yaml.MapSlice {
+		paths := [][]string{{}}
+		for _, p := range podTemplates[m.Head.Kind] {
+			if exists(doc, p) {
+				paths = append(paths, p)
+			}
+		}
+
+		for _, p := range paths {
+			meta := append(append([]string{}, p...), "metadata")
+
+			doc = setPath(doc, append(meta, "labels"), labels)
+			doc = setPath(doc, append(meta, "annotations"), annotations)
+		}
+
+		return doc
+	})
+}
+
+// edit parses the content of the manifest, and replaces it with the document
+// returned by fn.
+func (m *Manifest) edit(fn func(yaml.MapSlice) yaml.MapSlice) error {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(m.Content), &doc); err != nil {
+		return fmt.Errorf("%s: unable to parse resource: %s", m.Template, err)
+	}
+
+	b, err := yaml.Marshal(fn(doc))
+	if err != nil {
+		return err
+	}
+
+	return m.SetContent(string(b))
+}
+
+// setPath sets the values in the map at the given path of doc, creating any
+// missing maps along the way.
+func setPath(doc yaml.MapSlice, path []string, values map[string]string) yaml.MapSlice {
+	if len(path) == 0 {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			doc = set(doc, k, values[k])
+		}
+
+		return doc
+	}
+
+	if len(values) == 0 {
+		return doc
+	}
+
+	for i := range doc {
+		if doc[i].Key == path[0] {
+			sub, _ := doc[i].Value.(yaml.MapSlice)
+			doc[i].Value = setPath(sub, path[1:], values)
+			return doc
+		}
+	}
+
+	return append(doc, yaml.MapItem{Key: path[0], Value: setPath(nil, path[1:], values)})
+}
+
+func set(doc yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i := range doc {
+		if doc[i].Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+
+	return append(doc, yaml.MapItem{Key: key, Value: value})
+}
+
+// exists returns whether doc contains a map at the given path.
+func exists(doc yaml.MapSlice, path []string) bool {
+	for _, p := range path {
+		var found bool
+
+		for i := range doc {
+			if doc[i].Key == p {
+				doc, found = doc[i].Value.(yaml.MapSlice)
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
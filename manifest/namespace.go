@@ -0,0 +1,82 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ClusterScoped are the built-in kinds of resources that do not belong to a
+// namespace.
+var ClusterScoped = []string{
+	"APIService",
+	"CSIDriver",
+	"CSINode",
+	"CertificateSigningRequest",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"ComponentStatus",
+	"CustomResourceDefinition",
+	"FlowSchema",
+	"IngressClass",
+	"MutatingWebhookConfiguration",
+	"Namespace",
+	"Node",
+	"PersistentVolume",
+	"PodSecurityPolicy",
+	"PriorityClass",
+	"PriorityLevelConfiguration",
+	"RuntimeClass",
+	"SelfSubjectAccessReview",
+	"SelfSubjectRulesReview",
+	"StorageClass",
+	"SubjectAccessReview",
+	"TokenReview",
+	"ValidatingAdmissionPolicy",
+	"ValidatingAdmissionPolicyBinding",
+	"ValidatingWebhookConfiguration",
+	"VolumeAttachment",
+}
+
+// ClusterScopedKinds returns the kinds of cluster-scoped resources, being the
+// built-in ClusterScoped kinds, and the kinds of the cluster-scoped custom
+// resources defined in ms.
+func ClusterScopedKinds(ms []*Manifest) (map[string]bool, error) {
+	kinds := make(map[string]bool, len(ClusterScoped))
+	for _, k := range ClusterScoped {
+		kinds[k] = true
+	}
+
+	for _, m := range ms {
+		if m.Head.Kind != "CustomResourceDefinition" || !strings.HasPrefix(m.Head.APIVersion, "apiextensions.k8s.io/") {
+			continue
+		}
+
+		var crd struct {
+			Spec struct {
+				Scope string `yaml:"scope"`
+				Names struct {
+					Kind string `yaml:"kind"`
+				} `yaml:"names"`
+			} `yaml:"spec"`
+		}
+
+		if err := yaml.Unmarshal([]byte(m.Content), &crd); err != nil {
+			return nil, fmt.Errorf("%s: unable to parse resource: %s", m.Template, err)
+		}
+
+		if crd.Spec.Scope == "Cluster" {
+			kinds[crd.Spec.Names.Kind] = true
+		}
+	}
+
+	return kinds, nil
+}
+
+// SetNamespace sets the namespace of the resource.
+func (m *Manifest) SetNamespace(namespace string) error {
+	return m.edit(func(doc yaml.MapSlice) yaml.MapSlice {
+		return setPath(doc, []string{"metadata"}, map[string]string{"namespace": namespace})
+	})
+}
@@ -0,0 +1,243 @@
+package manifest
+
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// nameSuffixLength is the number of hexadecimal characters of the data hash
+// appended to the names of ConfigMaps and Secrets.
+const nameSuffixLength = 10
+
+// containerFields are the fields of a pod spec containing containers.
+var containerFields = []string{"containers", "initContainers", "ephemeralContainers"}
+
+// nameReferences are the paths of the fields within a pod spec referencing a
+// ConfigMap or Secret by name, by kind. Lists along the paths are traversed.
+var nameReferences = map[string][][]string{
+	"ConfigMap": {
+		{"volumes", "configMap", "name"},
+		{"volumes", "projected", "sources", "configMap", "name"},
+	},
+	"Secret": {
+		{"volumes", "secret", "secretName"},
+		{"volumes", "projected", "sources", "secret", "name"},
+		{"imagePullSecrets", "name"},
+	},
+}
+
+// serviceAccountReferences are the paths of the fields within a ServiceAccount
+// referencing a Secret by name.
+var serviceAccountReferences = [][]string{
+	{"secrets", "name"},
+	{"imagePullSecrets", "name"},
+}
+
+// ruleResources are the kinds whose names are matched by the resourceNames of
+// an RBAC rule, by the resources of the rule.
+var ruleResources = map[string][]string{
+	"configmaps": {"ConfigMap"},
+	"secrets":    {"Secret"},
+	"*":          {"ConfigMap", "Secret"},
+}
+
+// containerReferences are the paths of the fields within a container
+// referencing a ConfigMap or Secret by name, by kind.
+var containerReferences = map[string][][]string{
+	"ConfigMap": {
+		{"envFrom", "configMapRef", "name"},
+		{"env", "valueFrom", "configMapKeyRef", "name"},
+	},
+	"Secret": {
+		{"envFrom", "secretRef", "name"},
+		{"env", "valueFrom", "secretKeyRef", "name"},
+	},
+}
+
+// SetNameSuffixHashes appends a hash of their data to the names of the
+// ConfigMaps and Secrets in ms, and rewrites the references to them in the pod
+// specs of the Pods and workloads (Deployment, StatefulSet, Job, ...) in ms,
+// in the TLS configuration of Ingresses, in the secrets and imagePullSecrets
+// of ServiceAccounts, and in the resourceNames of Role and ClusterRole rules.
+// Since any change to the data results in a new name, workloads are rolled
+// out, and can be rolled back, along with their configuration.
+func SetNameSuffixHashes(ms []*Manifest) error {
+	names := map[string]map[string]string{}
+
+	for _, m := range ms {
+		if !isConfig(m) {
+			continue
+		}
+
+		h, err := m.dataHash()
+		if err != nil {
+			return err
+		}
+
+		name := m.Head.Metadata.Name
+		if names[m.Head.Kind] == nil {
+			names[m.Head.Kind] = map[string]string{}
+		}
+		names[m.Head.Kind][name] = fmt.Sprintf("%s-%x", name, h)[:len(name)+1+nameSuffixLength]
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	for _, m := range ms {
+		var fn func(yaml.MapSlice)
+
+		switch kind, spec := m.Head.Kind, podSpec(m.Head.Kind); {
+		case isConfig(m):
+			fn = func(doc yaml.MapSlice) { rename(doc, []string{"metadata", "name"}, names[kind]) }
+		case kind == "Ingress":
+			fn = func(doc yaml.MapSlice) { rename(doc, []string{"spec", "tls", "secretName"}, names["Secret"]) }
+		case kind == "ServiceAccount":
+			fn = func(doc yaml.MapSlice) {
+				for _, p := range serviceAccountReferences {
+					rename(doc, p, names["Secret"])
+				}
+			}
+		case kind == "Role" || kind == "ClusterRole":
+			fn = func(doc yaml.MapSlice) { renameResourceNames(doc, names) }
+		case spec != nil:
+			fn = func(doc yaml.MapSlice) { renameReferences(doc, spec, names) }
+		default:
+			continue
+		}
+
+		err := m.edit(func(doc yaml.MapSlice) yaml.MapSlice {
+			fn(doc)
+			return doc
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// podSpec returns the path of the pod spec of a Pod or workload resource, or
+// nil for other kinds.
+func podSpec(kind string) []string {
+	if kind == "Pod" {
+		return []string{"spec"}
+	}
+
+	paths := podTemplates[kind]
+	if len(paths) == 0 {
+		return nil
+	}
+
+	return append(append([]string{}, paths[len(paths)-1]...), "spec")
+}
+
+// renameReferences renames the ConfigMaps and Secrets referenced by the pod
+// spec at the given path of doc.
+func renameReferences(doc yaml.MapSlice, spec []string, names map[string]map[string]string) {
+	for kind, paths := range nameReferences {
+		for _, p := range paths {
+			rename(doc, append(append([]string{}, spec...), p...), names[kind])
+		}
+	}
+
+	for kind, paths := range containerReferences {
+		for _, f := range containerFields {
+			for _, p := range paths {
+				rename(doc, append(append(append([]string{}, spec...), f), p...), names[kind])
+			}
+		}
+	}
+}
+
+// renameResourceNames renames the ConfigMaps and Secrets in the resourceNames
+// of the rules of a Role or ClusterRole. A rule granting access to both kinds
+// gets the new names of both for a name used by both.
+func renameResourceNames(doc yaml.MapSlice, names map[string]map[string]string) {
+	for _, item := range doc {
+		rules, ok := item.Value.([]interface{})
+		if !ok || item.Key != "rules" {
+			continue
+		}
+
+		for _, r := range rules {
+			rule, _ := r.(yaml.MapSlice)
+
+			var kinds []string
+			for _, item := range rule {
+				if resources, ok := item.Value.([]interface{}); ok && item.Key == "resources" {
+					for _, res := range resources {
+						name, _ := res.(string)
+						kinds = append(kinds, ruleResources[name]...)
+					}
+				}
+			}
+
+			for i := range rule {
+				resourceNames, ok := rule[i].Value.([]interface{})
+				if !ok || rule[i].Key != "resourceNames" {
+					continue
+				}
+
+				var out []interface{}
+				for _, n := range resourceNames {
+					out = append(out, renamed(n, kinds, names)...)
+				}
+				rule[i].Value = out
+			}
+		}
+	}
+}
+
+// renamed returns the new names of a resource name for the given kinds, or
+// the name itself if it has no new name.
+func renamed(n interface{}, kinds []string, names map[string]map[string]string) []interface{} {
+	var out []interface{}
+	seen := map[string]bool{}
+	name, _ := n.(string)
+
+	for _, k := range kinds {
+		if nn, ok := names[k][name]; ok && !seen[nn] {
+			seen[nn] = true
+			out = append(out, nn)
+		}
+	}
+
+	if len(out) == 0 {
+		return []interface{}{n}
+	}
+
+	return out
+}
+
+// rename replaces the string at the given path of v by its new name, if it has
+// one. Lists along the path are traversed element by element.
+func rename(v interface{}, path []string, names map[string]string) interface{} {
+	switch t := v.(type) {
+	case yaml.MapSlice:
+		if len(path) == 0 {
+			return v
+		}
+
+		for i := range t {
+			if t[i].Key == path[0] {
+				t[i].Value = rename(t[i].Value, path[1:], names)
+			}
+		}
+
+	case []interface{}:
+		for i := range t {
+			t[i] = rename(t[i], path, names)
+		}
+
+	case string:
+		if n, ok := names[t]; ok && len(path) == 0 {
+			return n
+		}
+	}
+
+	return v
+}
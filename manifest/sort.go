@@ -0,0 +1,79 @@
+package manifest
+
+import "sort"
+
+const (
+	// TemplateOrder orders manifests by the path of the template that
+	// rendered them, keeping the charts in the order they are configured.
+	TemplateOrder = "template"
+
+	// KindOrder orders manifests using Helm's install order, based on the kind
+	// of resource.
+	KindOrder = "kind"
+)
+
+// InstallOrder is the order in which Helm installs resources, by kind. Kinds
+// not in this list are installed last.
+var InstallOrder = []string{
+	"Namespace",
+	"ResourceQuota",
+	"LimitRange",
+	"PodSecurityPolicy",
+	"PodDisruptionBudget",
+	"Secret",
+	"ConfigMap",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"ServiceAccount",
+	"CustomResourceDefinition",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"Ingress",
+	"APIService",
+}
+
+// SortByTemplate sorts the manifests by their template path. Manifests
+// rendered from the same template keep their relative order.
+func SortByTemplate(ms []*Manifest) {
+	sort.SliceStable(ms, func(i, j int) bool {
+		return ms[i].Template < ms[j].Template
+	})
+}
+
+// SortByKind sorts the manifests by their kind, using InstallOrder. Unknown
+// kinds are sorted alphabetically, after all known kinds. Manifests of the
+// same kind keep their relative order.
+func SortByKind(ms []*Manifest) {
+	order := make(map[string]int, len(InstallOrder))
+	for i, k := range InstallOrder {
+		order[k] = i
+	}
+
+	sort.SliceStable(ms, func(i, j int) bool {
+		ki, kj := ms[i].Head.Kind, ms[j].Head.Kind
+
+		oi, iok := order[ki]
+		oj, jok := order[kj]
+
+		switch {
+		case iok && jok:
+			return oi < oj
+		case iok != jok:
+			return iok
+		default:
+			return ki < kj
+		}
+	})
+}
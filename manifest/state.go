@@ -0,0 +1,158 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Resource identifies a rendered resource.
+type Resource struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Namespace  string `yaml:"namespace,omitempty"`
+	Name       string `yaml:"name"`
+}
+
+// State contains the identities of all resources rendered by a run, so that
+// the next run can determine which resources are no longer rendered.
+type State struct {
+	Resources []*Resource `yaml:"resources"`
+}
+
+// NewState returns the state of the rendered manifests, ordered by kind,
+// namespace and name.
+func NewState(ms []*Manifest) *State {
+	s := &State{}
+	seen := map[Resource]bool{}
+
+	for _, m := range ms {
+		if m.Head.Kind == "" {
+			continue
+		}
+
+		r := Resource{
+			APIVersion: m.Head.APIVersion,
+			Kind:       m.Head.Kind,
+			Namespace:  m.Head.Metadata.Namespace,
+			Name:       m.Head.Metadata.Name,
+		}
+
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+
+		s.Resources = append(s.Resources, &r)
+	}
+
+	sort.SliceStable(s.Resources, func(i, j int) bool {
+		a, b := s.Resources[i], s.Resources[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	return s
+}
+
+// LoadState reads the state file at the given path. If the file does not
+// exist, an empty state is returned.
+func LoadState(path string) (*State, error) {
+	s := &State{}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return s, nil
+}
+
+// WriteFile writes the state to the given path, if its content changed.
+func (s *State) WriteFile(path string) error {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	current, err := ioutil.ReadFile(path)
+	if err == nil && bytes.Equal(current, b) {
+		return nil
+	}
+
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Removed returns the resources in s that are not in current. Resources are
+// matched by kind, namespace and name, so that a resource of which only the
+// apiVersion changed, which is still the same object in the cluster, is not
+// considered removed.
+func (s *State) Removed(current *State) []*Resource {
+	rendered := map[Resource]bool{}
+	for _, r := range current.Resources {
+		rendered[Resource{Kind: r.Kind, Namespace: r.Namespace, Name: r.Name}] = true
+	}
+
+	var removed []*Resource
+	for _, r := range s.Resources {
+		if !rendered[Resource{Kind: r.Kind, Namespace: r.Namespace, Name: r.Name}] {
+			removed = append(removed, r)
+		}
+	}
+
+	return removed
+}
+
+// String returns the identity of the resource, in the same format as the Key
+// of a manifest.
+func (r *Resource) String() string {
+	name := r.Name
+	if r.Namespace != "" {
+		name = r.Namespace + "/" + name
+	}
+
+	return fmt.Sprintf("%s %s %s", r.APIVersion, r.Kind, name)
+}
+
+// EncodeDelete returns a YAML stream of the resources, containing only their
+// apiVersion, kind and metadata, to be used with "kubectl delete -f".
+func EncodeDelete(rs []*Resource) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, r := range rs {
+		meta := yaml.MapSlice{{Key: "name", Value: r.Name}}
+		if r.Namespace != "" {
+			meta = append(meta, yaml.MapItem{Key: "namespace", Value: r.Namespace})
+		}
+
+		b, err := yaml.Marshal(yaml.MapSlice{
+			{Key: "apiVersion", Value: r.APIVersion},
+			{Key: "kind", Value: r.Kind},
+			{Key: "metadata", Value: meta},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		buf.WriteString("---\n")
+		buf.Write(b)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/blendle/kubecrt/manifest"
+	"github.com/ghodss/yaml"
+)
+
+const crdKind = "CustomResourceDefinition"
+
+type crd struct {
+	Spec struct {
+		Group string `json:"group"`
+		Names struct {
+			Kind string `json:"kind"`
+		} `json:"names"`
+		Version    string         `json:"version"`
+		Validation *crdValidation `json:"validation"`
+		Versions   []struct {
+			Name   string         `json:"name"`
+			Schema *crdValidation `json:"schema"`
+		} `json:"versions"`
+	} `json:"spec"`
+}
+
+type crdValidation struct {
+	OpenAPIV3Schema *Schema `json:"openAPIV3Schema"`
+}
+
+// AddCRD registers the schemas of a custom resource definition. Manifests of
+// any other kind are ignored.
+func (v *Validator) AddCRD(m *manifest.Manifest) error {
+	if m.Head.Kind != crdKind || !strings.HasPrefix(m.Head.APIVersion, "apiextensions.k8s.io/") {
+		return nil
+	}
+
+	b, err := yaml.YAMLToJSON([]byte(m.Content))
+	if err != nil {
+		return err
+	}
+
+	var c crd
+	if err = json.Unmarshal(b, &c); err != nil {
+		return fmt.Errorf("invalid custom resource definition: %s", err)
+	}
+
+	// apiextensions.k8s.io/v1beta1 allows a single schema for all versions.
+	if c.Spec.Validation != nil && c.Spec.Validation.OpenAPIV3Schema != nil {
+		if c.Spec.Version != "" {
+			v.addKind(c.Spec.Group, c.Spec.Version, c.Spec.Names.Kind, c.Spec.Validation.OpenAPIV3Schema)
+		}
+
+		for _, ver := range c.Spec.Versions {
+			v.addKind(c.Spec.Group, ver.Name, c.Spec.Names.Kind, c.Spec.Validation.OpenAPIV3Schema)
+		}
+	}
+
+	for _, ver := range c.Spec.Versions {
+		if ver.Schema != nil && ver.Schema.OpenAPIV3Schema != nil {
+			v.addKind(c.Spec.Group, ver.Name, c.Spec.Names.Kind, ver.Schema.OpenAPIV3Schema)
+		}
+	}
+
+	return nil
+}
+
+// addKind registers the schema of a custom resource. The apiVersion, kind and
+// metadata fields are implicitly part of every custom resource.
+func (v *Validator) addKind(group, version, kind string, s *Schema) {
+	root := *s
+	root.Properties = map[string]*Schema{
+		"apiVersion": {Type: "string"},
+		"kind":       {Type: "string"},
+		"metadata":   {Ref: definitionPrefix + objectMeta},
+	}
+
+	for k, p := range s.Properties {
+		if k != "metadata" {
+			root.Properties[k] = p
+		}
+	}
+
+	v.kinds[kindKey(group, version, kind)] = &root
+}
+
+// loadCRDs registers the custom resource definitions in all YAML and JSON
+// files in dir.
+func (v *Validator) loadCRDs(dir string) error {
+	ms, err := manifest.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range ms {
+		if err = v.AddCRD(m); err != nil {
+			return fmt.Errorf("%s: %s", m.Template, err)
+		}
+	}
+
+	return nil
+}
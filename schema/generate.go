@@ -0,0 +1,151 @@
+//go:build ignore
+// +build ignore
+
+// generate downloads the OpenAPI specification of the given Kubernetes
+// versions, and stores the definitions relevant for validating resources in
+// kubernetes/VERSION.json.gz.
+//
+// Usage:
+//
+//	go run generate.go [-source URL] VERSION...
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// keep are the schema keywords used by the validator.
+var keep = map[string]bool{
+	"type":                                 true,
+	"format":                               true,
+	"$ref":                                 true,
+	"properties":                           true,
+	"additionalProperties":                 true,
+	"items":                                true,
+	"required":                             true,
+	"enum":                                 true,
+	"x-kubernetes-group-version-kind":      true,
+	"x-kubernetes-preserve-unknown-fields": true,
+	"x-kubernetes-int-or-string":           true,
+	"x-kubernetes-patch-strategy":          true,
+	"x-kubernetes-patch-merge-key":         true,
+}
+
+func main() {
+	source := flag.String(
+		"source",
+		"https://raw.githubusercontent.com/kubernetes/kubernetes/%s/api/openapi-spec/swagger.json",
+		"location of the OpenAPI specification, with %s replaced by the version",
+	)
+	flag.Parse()
+
+	for _, v := range flag.Args() {
+		if err := generate(fmt.Sprintf(*source, v), v); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", v, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func generate(source, version string) error {
+	b, err := read(source)
+	if err != nil {
+		return err
+	}
+
+	var spec struct {
+		Definitions map[string]map[string]interface{} `json:"definitions"`
+	}
+
+	if err = json.Unmarshal(b, &spec); err != nil {
+		return err
+	}
+
+	defs := map[string]interface{}{}
+	for name, def := range spec.Definitions {
+		// Quantities are defined as strings, but also accept numbers.
+		if strings.HasSuffix(name, ".api.resource.Quantity") {
+			def["format"] = "quantity"
+		}
+
+		defs[name] = trim(def)
+	}
+
+	// Only keep the minor version, patch releases do not change the API.
+	p := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(p) < 2 {
+		return fmt.Errorf("invalid version")
+	}
+
+	f, err := os.Create(filepath.Join("kubernetes", "v"+p[0]+"."+p[1]+".json.gz"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	if err = json.NewEncoder(w).Encode(defs); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func trim(def map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+
+	for k, v := range def {
+		if !keep[k] {
+			continue
+		}
+
+		switch k {
+		case "properties":
+			props := map[string]interface{}{}
+			for name, p := range v.(map[string]interface{}) {
+				props[name] = trim(p.(map[string]interface{}))
+			}
+			out[k] = props
+		case "items", "additionalProperties":
+			if s, ok := v.(map[string]interface{}); ok {
+				out[k] = trim(s)
+				continue
+			}
+			out[k] = v
+		default:
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+func read(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+
+	resp, err := http.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to download %s: %s", source, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
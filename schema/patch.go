@@ -0,0 +1,240 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const patchDirective = "$patch"
+
+// Patcher applies strategic merge patches to resources, using the patch
+// strategies defined in the schemas of a Kubernetes version.
+type Patcher struct {
+	definitions map[string]*Schema
+	kinds       map[string]*Schema
+}
+
+// NewPatcher returns a patcher using the bundled schemas of the given
+// Kubernetes version. If no version is given, the newest bundled version is
+// used.
+func NewPatcher(kubeVersion string) (*Patcher, error) {
+	defs, err := loadDefinitions(kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Patcher{definitions: defs, kinds: indexKinds(defs)}, nil
+}
+
+// StrategicMerge applies a strategic merge patch to a resource, both in their
+// JSON representation. Lists are merged by the merge key of their field, if
+// its patch strategy is "merge", and replaced otherwise. Null values remove
+// fields, and the "$patch: replace" and "$patch: delete" directives replace
+// or remove a map or list element. Resources without a known schema, such as
+// custom resources, are patched as a JSON merge patch, replacing all lists.
+func (p *Patcher) StrategicMerge(apiVersion, kind string, original, patch map[string]interface{}) (map[string]interface{}, error) {
+	return p.mergeMap(p.kinds[apiVersionKey(apiVersion, kind)], original, patch, "")
+}
+
+// MergeKey returns the merge key of the elements of a list field, such as
+// "name" for the containers of a pod, or an empty string if the elements are
+// not identified by a key. The field is given by the keys of the maps leading
+// up to it, from the root of the resource, skipping any list indexes.
+func (p *Patcher) MergeKey(apiVersion, kind string, fields []string) string {
+	s := p.resolve(p.kinds[apiVersionKey(apiVersion, kind)])
+
+	for _, f := range fields {
+		if s != nil && s.Items != nil {
+			s = p.resolve(s.Items)
+		}
+
+		s = p.resolve(p.property(s, f))
+	}
+
+	if s == nil || s.Items == nil {
+		return ""
+	}
+
+	return s.PatchMergeKey
+}
+
+func (p *Patcher) mergeMap(s *Schema, original, patch map[string]interface{}, path string) (map[string]interface{}, error) {
+	s = p.resolve(s)
+
+	switch d := patch[patchDirective]; d {
+	case nil:
+	case "replace":
+		out := make(map[string]interface{}, len(patch))
+		for k, v := range patch {
+			if k != patchDirective {
+				out[k] = v
+			}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported directive %s: %v", pathOrRoot(path), patchDirective, d)
+	}
+
+	out := make(map[string]interface{}, len(original)+len(patch))
+	for k, v := range original {
+		out[k] = v
+	}
+
+	for k, v := range patch {
+		if strings.HasPrefix(k, "$") {
+			return nil, fmt.Errorf("%s: unsupported directive %s", pathOrRoot(path), k)
+		}
+
+		if v == nil || isDelete(v) {
+			delete(out, k)
+			continue
+		}
+
+		merged, err := p.mergeValue(p.property(s, k), out[k], v, join(path, k))
+		if err != nil {
+			return nil, err
+		}
+
+		out[k] = merged
+	}
+
+	return out, nil
+}
+
+func (p *Patcher) mergeValue(s *Schema, original, patch interface{}, path string) (interface{}, error) {
+	switch pv := patch.(type) {
+	case map[string]interface{}:
+		om, _ := original.(map[string]interface{})
+		return p.mergeMap(s, om, pv, path)
+
+	case []interface{}:
+		if s == nil || !strings.Contains(s.PatchStrategy, "merge") {
+			return pv, nil
+		}
+
+		ol, _ := original.([]interface{})
+		if s.PatchMergeKey == "" {
+			return mergePrimitives(ol, pv), nil
+		}
+
+		return p.mergeList(s.Items, s.PatchMergeKey, ol, pv, path)
+	}
+
+	return patch, nil
+}
+
+// mergeList merges the elements of a list of maps by their merge key.
+func (p *Patcher) mergeList(s *Schema, key string, original, patch []interface{}, path string) ([]interface{}, error) {
+	out := append([]interface{}{}, original...)
+
+	for i, e := range patch {
+		if m, ok := e.(map[string]interface{}); ok && len(m) == 1 && m[patchDirective] == "replace" {
+			return append(append([]interface{}{}, patch[:i]...), patch[i+1:]...), nil
+		}
+	}
+
+	for i, e := range patch {
+		pm, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s[%d]: expected object, merged by %q", path, i, key)
+		}
+
+		kv, ok := pm[key]
+		if !ok {
+			return nil, fmt.Errorf("%s[%d]: missing merge key %q", path, i, key)
+		}
+
+		j := indexOf(out, key, kv)
+
+		if isDelete(pm) {
+			if j >= 0 {
+				out = append(out[:j], out[j+1:]...)
+			}
+			continue
+		}
+
+		var om map[string]interface{}
+		if j >= 0 {
+			om, _ = out[j].(map[string]interface{})
+		}
+
+		merged, err := p.mergeMap(s, om, pm, fmt.Sprintf("%s[%s=%v]", path, key, kv))
+		if err != nil {
+			return nil, err
+		}
+
+		if j >= 0 {
+			out[j] = merged
+			continue
+		}
+
+		out = append(out, merged)
+	}
+
+	return out, nil
+}
+
+// mergePrimitives adds the values in patch that are not in original yet.
+func mergePrimitives(original, patch []interface{}) []interface{} {
+	out := append([]interface{}{}, original...)
+
+	for _, v := range patch {
+		var found bool
+		for _, o := range out {
+			if reflect.DeepEqual(o, v) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+func (p *Patcher) resolve(s *Schema) *Schema {
+	if s == nil || s.Ref == "" {
+		return s
+	}
+
+	return p.definitions[strings.TrimPrefix(s.Ref, definitionPrefix)]
+}
+
+func (p *Patcher) property(s *Schema, key string) *Schema {
+	if s == nil {
+		return nil
+	}
+
+	if ps, ok := s.Properties[key]; ok {
+		return ps
+	}
+
+	return s.AdditionalProperties
+}
+
+func indexOf(l []interface{}, key string, value interface{}) int {
+	for i, e := range l {
+		if m, ok := e.(map[string]interface{}); ok && reflect.DeepEqual(m[key], value) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func isDelete(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	return ok && m[patchDirective] == "delete"
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+
+	return path
+}
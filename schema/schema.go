@@ -0,0 +1,157 @@
+package schema
+
+//go:generate go run generate.go v1.19.0 v1.20.0 v1.21.0 v1.22.0 v1.23.0 v1.24.0 v1.25.0 v1.26.0 v1.27.0 v1.28.0
+
+import (
+	"compress/gzip"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed kubernetes/*.json.gz
+var bundled embed.FS
+
+// Schema is the subset of an OpenAPI schema used to validate resources.
+type Schema struct {
+	Type                  string             `json:"type"`
+	Format                string             `json:"format"`
+	Ref                   string             `json:"$ref"`
+	Properties            map[string]*Schema `json:"properties"`
+	AdditionalProperties  *Schema            `json:"-"`
+	Items                 *Schema            `json:"items"`
+	Required              []string           `json:"required"`
+	Enum                  []interface{}      `json:"enum"`
+	PreserveUnknownFields bool               `json:"x-kubernetes-preserve-unknown-fields"`
+	IntOrString           bool               `json:"x-kubernetes-int-or-string"`
+	PatchStrategy         string             `json:"x-kubernetes-patch-strategy"`
+	PatchMergeKey         string             `json:"x-kubernetes-patch-merge-key"`
+	GroupVersionKind      []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The additionalProperties keyword
+// is either a schema, or a boolean, in which case true allows any value.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	type schema Schema
+	aux := struct {
+		*schema
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}{schema: (*schema)(s)}
+
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	switch strings.TrimSpace(string(aux.AdditionalProperties)) {
+	case "", "false", "null":
+	case "true":
+		s.AdditionalProperties = &Schema{}
+	default:
+		s.AdditionalProperties = &Schema{}
+		return json.Unmarshal(aux.AdditionalProperties, s.AdditionalProperties)
+	}
+
+	return nil
+}
+
+// KubeVersions returns the Kubernetes versions for which schemas are bundled,
+// from oldest to newest.
+func KubeVersions() []string {
+	files, _ := bundled.ReadDir("kubernetes")
+
+	var versions []string
+	for _, f := range files {
+		versions = append(versions, strings.TrimSuffix(f.Name(), ".json.gz"))
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return minor(versions[i]) < minor(versions[j])
+	})
+
+	return versions
+}
+
+// loadDefinitions returns the bundled schema definitions of a Kubernetes
+// version, in any of the "1.24", "v1.24" or "v1.24.3" formats. If no version
+// is given, the newest bundled version is used.
+func loadDefinitions(version string) (map[string]*Schema, error) {
+	versions := KubeVersions()
+
+	if version == "" {
+		version = versions[len(versions)-1]
+	}
+
+	p := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(p) < 2 {
+		return nil, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+
+	f, err := bundled.Open(path.Join("kubernetes", "v"+p[0]+"."+p[1]+".json.gz"))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"no schemas available for Kubernetes version %s, supported versions are %s",
+			version, strings.Join(versions, ", "),
+		)
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	defs := map[string]*Schema{}
+	if err = json.NewDecoder(r).Decode(&defs); err != nil {
+		return nil, err
+	}
+
+	return defs, nil
+}
+
+// APIVersions returns the API versions served by a Kubernetes version, in both
+// the "group/version" and "group/version/Kind" formats, sorted alphabetically.
+func APIVersions(version string) ([]string, error) {
+	defs, err := loadDefinitions(version)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, s := range defs {
+		for _, gvk := range s.GroupVersionKind {
+			gv := gvk.Version
+			if gvk.Group != "" {
+				gv = gvk.Group + "/" + gvk.Version
+			}
+
+			seen[gv] = true
+			seen[gv+"/"+gvk.Kind] = true
+		}
+	}
+
+	versions := make([]string, 0, len(seen))
+	for v := range seen {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+
+	return versions, nil
+}
+
+func minor(version string) int {
+	p := strings.Split(version, ".")
+	if len(p) < 2 {
+		return 0
+	}
+
+	i, _ := strconv.Atoi(p[1])
+	return i
+}
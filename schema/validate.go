@@ -0,0 +1,303 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blendle/kubecrt/manifest"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const definitionPrefix = "#/definitions/"
+
+const objectMeta = "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+
+// Validator validates resources against the schemas of a Kubernetes version,
+// and any registered custom resource definitions.
+type Validator struct {
+	definitions map[string]*Schema
+	kinds       map[string]*Schema
+}
+
+// Violation is a single schema violation found in a resource.
+type Violation struct {
+	Chart    string
+	Template string
+	Kind     string
+	Name     string
+	Path     string
+	Message  string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s: %s: %s %s: %s: %s", v.Chart, v.Template, v.Kind, v.Name, v.Path, v.Message)
+}
+
+// NewValidator returns a validator using the bundled schemas of the given
+// Kubernetes version. If crdDir is not empty, the schemas of all custom
+// resource definitions in that directory are registered as well.
+func NewValidator(kubeVersion, crdDir string) (*Validator, error) {
+	defs, err := loadDefinitions(kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Validator{definitions: defs, kinds: indexKinds(defs)}
+
+	if crdDir != "" {
+		if err = v.loadCRDs(crdDir); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// Validate validates the manifests, and returns all violations found.
+// Custom resource definitions in the manifests are registered before any of
+// the manifests are validated.
+func (v *Validator) Validate(ms []*manifest.Manifest) ([]*Violation, error) {
+	for _, m := range ms {
+		if err := v.AddCRD(m); err != nil {
+			return nil, fmt.Errorf("%s: %s", m.Template, err)
+		}
+	}
+
+	var violations []*Violation
+
+	for _, m := range ms {
+		if m.Head.Kind == "" {
+			continue
+		}
+
+		var obj interface{}
+		if err := yaml.Unmarshal([]byte(m.Content), &obj); err != nil {
+			return nil, fmt.Errorf("%s: %s", m.Template, err)
+		}
+
+		report := func(path, msg string) {
+			if path == "" {
+				path = "(root)"
+			}
+
+			violations = append(violations, &Violation{
+				Chart:    m.Chart,
+				Template: m.Template,
+				Kind:     m.Head.Kind,
+				Name:     m.Head.Metadata.Name,
+				Path:     path,
+				Message:  msg,
+			})
+		}
+
+		s, ok := v.kinds[apiVersionKey(m.Head.APIVersion, m.Head.Kind)]
+		if !ok {
+			report("", fmt.Sprintf("no schema found for apiVersion %q and kind %q", m.Head.APIVersion, m.Head.Kind))
+			continue
+		}
+
+		v.validate(s, obj, "", report)
+	}
+
+	return violations, nil
+}
+
+func (v *Validator) validate(s *Schema, value interface{}, path string, report func(string, string)) {
+	if s.Ref != "" {
+		ref, ok := v.definitions[strings.TrimPrefix(s.Ref, definitionPrefix)]
+		if !ok {
+			return
+		}
+		s = ref
+	}
+
+	if value == nil || s.PreserveUnknownFields && s.Type == "" {
+		return
+	}
+
+	if s.IntOrString || s.Format == "int-or-string" {
+		if !isInteger(value) && !isString(value) {
+			report(path, fmt.Sprintf("expected integer or string, got %s", typeOf(value)))
+		}
+		return
+	}
+
+	switch s.Type {
+	case "string":
+		if s.Format == "quantity" && isNumber(value) {
+			return
+		}
+		if !isString(value) {
+			report(path, fmt.Sprintf("expected string, got %s", typeOf(value)))
+			return
+		}
+	case "integer":
+		if !isInteger(value) {
+			report(path, fmt.Sprintf("expected integer, got %s", typeOf(value)))
+			return
+		}
+	case "number":
+		if !isNumber(value) {
+			report(path, fmt.Sprintf("expected number, got %s", typeOf(value)))
+			return
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report(path, fmt.Sprintf("expected boolean, got %s", typeOf(value)))
+			return
+		}
+	case "array":
+		l, ok := value.([]interface{})
+		if !ok {
+			report(path, fmt.Sprintf("expected array, got %s", typeOf(value)))
+			return
+		}
+
+		if s.Items != nil {
+			for i := range l {
+				v.validate(s.Items, l[i], fmt.Sprintf("%s[%d]", path, i), report)
+			}
+		}
+	case "object", "":
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			if s.Type == "object" {
+				report(path, fmt.Sprintf("expected object, got %s", typeOf(value)))
+			}
+			return
+		}
+
+		v.validateObject(s, m, path, report)
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		report(path, fmt.Sprintf("unsupported value %v, expected one of %v", value, s.Enum))
+	}
+}
+
+func (v *Validator) validateObject(s *Schema, m map[interface{}]interface{}, path string, report func(string, string)) {
+	keys := make([]string, 0, len(m))
+	values := make(map[string]interface{}, len(m))
+
+	for k, val := range m {
+		key := fmt.Sprint(k)
+		keys = append(keys, key)
+		values[key] = val
+	}
+	sort.Strings(keys)
+
+	// Objects without any properties defined, such as raw extensions, accept
+	// any fields.
+	free := s.PreserveUnknownFields || (len(s.Properties) == 0 && s.AdditionalProperties == nil)
+
+	for _, k := range keys {
+		p := join(path, k)
+
+		if ps, ok := s.Properties[k]; ok {
+			v.validate(ps, values[k], p, report)
+			continue
+		}
+
+		if s.AdditionalProperties != nil {
+			v.validate(s.AdditionalProperties, values[k], p, report)
+			continue
+		}
+
+		if !free {
+			report(p, "unknown field")
+		}
+	}
+
+	for _, r := range s.Required {
+		if _, ok := values[r]; !ok {
+			report(join(path, r), "missing required field")
+		}
+	}
+}
+
+// indexKinds returns the definitions of all kinds of resources, by their
+// apiVersion and kind.
+func indexKinds(defs map[string]*Schema) map[string]*Schema {
+	kinds := map[string]*Schema{}
+
+	for _, s := range defs {
+		for _, gvk := range s.GroupVersionKind {
+			kinds[kindKey(gvk.Group, gvk.Version, gvk.Kind)] = s
+		}
+	}
+
+	return kinds
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+
+	return path + "." + field
+}
+
+func kindKey(group, version, kind string) string {
+	if group == "" {
+		return apiVersionKey(version, kind)
+	}
+
+	return apiVersionKey(group+"/"+version, kind)
+}
+
+func apiVersionKey(apiVersion, kind string) string {
+	return apiVersion + ", Kind=" + kind
+}
+
+func isString(v interface{}) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+func isInteger(v interface{}) bool {
+	switch v.(type) {
+	case int, int64, uint64:
+		return true
+	}
+
+	return false
+}
+
+func isNumber(v interface{}) bool {
+	_, ok := v.(float64)
+	return ok || isInteger(v)
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[interface{}]interface{}:
+		return "object"
+	}
+
+	if isInteger(v) {
+		return "integer"
+	}
+
+	if isNumber(v) {
+		return "number"
+	}
+
+	return fmt.Sprintf("%T", v)
+}